@@ -0,0 +1,46 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultAPIAddr is the address of the API of a booster server
+// running with the default configuration.
+const defaultAPIAddr = "http://localhost:7764"
+
+// apiAddr is the address of the API used by the command being run.
+var apiAddr string
+
+// apiClient is used by the commands that talk to a running booster
+// server through its API.
+var apiClient = &http.Client{Timeout: time.Second * 5}
+
+// apiError returns the error carried by the response of an API call that
+// failed, prefixed with `name`.
+func apiError(name string, resp *http.Response) error {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil || payload.Error == "" {
+		return fmt.Errorf("%s: unexpected response: %s", name, resp.Status)
+	}
+	return fmt.Errorf("%s: %s", name, payload.Error)
+}
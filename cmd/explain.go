@@ -0,0 +1,111 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/booster-proj/booster/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Explain configuration
+	explainNetwork string
+	explainClient  string
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain host:port",
+	Short: "Explain which source a running booster server would use for a connection",
+	Long: `Ask a running booster server how it would handle a connection to the target:
+which sources are accepted by the policies, which policy rejects the others,
+what the bind history says and which source the strategy would pick next.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		e, err := explain(apiAddr, args[0], explainNetwork, explainClient)
+		if err != nil {
+			return err
+		}
+		printExplanation(e)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().StringVar(&apiAddr, "api", defaultAPIAddr, "Address of the API of the booster server")
+	explainCmd.Flags().StringVar(&explainNetwork, "network", "", "Network of the connection, tcp or udp")
+	explainCmd.Flags().StringVar(&explainClient, "client", "", "Address of the proxy client that opens the connection")
+}
+
+// explain queries the explain endpoint of the API served at `addr`.
+func explain(addr, target, network, client string) (*store.Explanation, error) {
+	q := url.Values{"target": {target}}
+	if network != "" {
+		q.Set("network", network)
+	}
+	if client != "" {
+		q.Set("client", client)
+	}
+	resp, err := apiClient.Get(addr + "/explain.json?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError("explain", resp)
+	}
+
+	var e store.Explanation
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		return nil, fmt.Errorf("explain: unable to decode response: %v", err)
+	}
+	return &e, nil
+}
+
+func printExplanation(e *store.Explanation) {
+	fmt.Printf("Target: %s (%s)\n", e.Target, e.Network)
+	if e.Client != "" {
+		fmt.Printf("Client: %s\n", e.Client)
+	}
+	if e.BoundTo != "" {
+		fmt.Printf("Bound to: %s\n", e.BoundTo)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tACCEPTED\tPOLICY\tREASON")
+	for _, v := range e.Sources {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\n", v.ID, v.Accepted, v.Policy, v.Reason)
+	}
+	w.Flush()
+	fmt.Println()
+
+	if e.Next != "" {
+		fmt.Printf("Next: %s\n", e.Next)
+	} else {
+		fmt.Printf("No source available: %s\n", e.Error)
+	}
+}
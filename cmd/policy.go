@@ -0,0 +1,155 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/booster-proj/booster/store"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Policy configuration
+	exportOutput  string
+	importReplace bool
+)
+
+// policyCmd represents the policy command
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage the policies of a running booster server",
+}
+
+// policyExportCmd represents the policy export command
+var policyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the policies of a running booster server",
+	Long: `Print the policies of a running booster server as a versioned JSON
+document, which can be applied to another server with "booster policy import".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportOutput == "" || exportOutput == "-" {
+			return exportPolicies(apiAddr, os.Stdout)
+		}
+
+		// Export into memory first, so that a failed export never
+		// leaves an empty or partial file behind.
+		var buf bytes.Buffer
+		if err := exportPolicies(apiAddr, &buf); err != nil {
+			return err
+		}
+		return writeExport(exportOutput, buf.Bytes())
+	},
+}
+
+// writeExport writes `data` into the file at `path`, which is removed if
+// any write fails.
+func writeExport(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("export: unable to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// policyImportCmd represents the policy import command
+var policyImportCmd = &cobra.Command{
+	Use:   "import file",
+	Short: "Import policies into a running booster server",
+	Long: `Apply the policies of a document produced by "booster policy export", read
+from file or from the standard input when file is "-". The policies are added
+to the ones of the server, replacing those with the same identifier, or
+replace all of them with --replace. Either every policy is applied, or none is.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		mode := store.ImportMerge
+		if importReplace {
+			mode = store.ImportReplace
+		}
+		if err := importPolicies(apiAddr, data, mode); err != nil {
+			return err
+		}
+		fmt.Printf("Policies imported (%s)\n", mode)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyExportCmd, policyImportCmd)
+
+	policyCmd.PersistentFlags().StringVar(&apiAddr, "api", defaultAPIAddr, "Address of the API of the booster server")
+	policyExportCmd.Flags().StringVar(&exportOutput, "output", "", "File where the policies are written, instead of the standard output")
+	policyImportCmd.Flags().BoolVar(&importReplace, "replace", false, "Replace every policy of the server instead of merging")
+}
+
+// exportPolicies writes the policies exported by the API served at
+// `addr` into `w`.
+func exportPolicies(addr string, w io.Writer) error {
+	resp, err := apiClient.Get(addr + "/policies/export")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError("export", resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// importPolicies sends the policy document `data` to the API served at
+// `addr`, to be applied in `mode`.
+func importPolicies(addr string, data []byte, mode string) error {
+	q := url.Values{"mode": {mode}}
+	resp, err := apiClient.Post(addr+"/policies/import?"+q.Encode(), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError("import", resp)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"reflect"
+
+	"github.com/booster-proj/booster/config"
+	"github.com/booster-proj/booster/source"
+	"github.com/booster-proj/booster/store"
+	"upspin.io/log"
+)
+
+// reloader applies the differences between the configuration that is
+// running and a new one, without restarting the server.
+type reloader struct {
+	load   func() (*config.Config, error)
+	cur    *config.Config
+	store  *store.SourceStore
+	filter *source.Filter
+}
+
+// Reload loads the configuration again and applies it. If the new
+// configuration is not valid, the one currently running is kept.
+func (r *reloader) Reload() error {
+	c, err := r.load()
+	if err != nil {
+		return err
+	}
+	return r.apply(c)
+}
+
+// apply changes the policies issued by the configuration, the balancing
+// strategy and the interface filter to match `c`. Policy changes are
+// applied before anything else, as they are the only ones that might fail
+// after `c` has been validated: the removed and the new policies in a single
+// atomic operation, then the changed ones in place, one at a time, so that
+// they keep their position among the other policies. Policies of `c` that
+// have the identifier of a policy of another issuer replace it.
+func (r *reloader) apply(c *config.Config) error {
+	ch, err := r.policiesDiff(c)
+	if err != nil {
+		return err
+	}
+	if len(ch.del) > 0 || len(ch.add) > 0 {
+		if err := r.store.UpdatePolicies(ch.del, ch.add); err != nil {
+			return err
+		}
+	}
+	for _, p := range ch.update {
+		rec, _ := store.MakePolicyRecord(p)
+		if _, err := r.store.UpdatePolicy(p.ID(), config.Issuer, func(store.PolicyRecord) (store.PolicyRecord, error) {
+			return rec, nil
+		}); err != nil {
+			return err
+		}
+		log.Info.Printf("Config: policy %s changed", p.ID())
+	}
+	for _, id := range ch.del {
+		if issuer, ok := ch.replaced[id]; ok {
+			log.Info.Printf("Config: policy %s issued by %s replaced", id, issuer)
+			continue
+		}
+		log.Info.Printf("Config: policy %s removed", id)
+	}
+	for _, p := range ch.add {
+		log.Info.Printf("Config: policy %s added", p.ID())
+		if rec, ok := store.MakePolicyRecord(p); ok && rec.Network == "udp" {
+			log.Error.Printf("Config: policy %s matches only UDP connections, which the proxy does not dial yet", p.ID())
+		}
+	}
+
+	if name := r.store.StrategyName(); name != c.Strategy {
+		if err := r.store.UseStrategy(c.Strategy); err != nil {
+			return err
+		}
+		log.Info.Printf("Config: strategy changed from %s to %s", name, c.Strategy)
+	}
+
+	include, exclude := r.filter.Rules()
+	if !equalStrings(include, c.Interfaces.Include) || !equalStrings(exclude, c.Interfaces.Exclude) {
+		if err := r.filter.Update(c.Interfaces.Include, c.Interfaces.Exclude); err != nil {
+			return err
+		}
+		log.Info.Printf("Config: interface filter changed to include %v, exclude %v", c.Interfaces.Include, c.Interfaces.Exclude)
+	}
+
+	if r.cur != nil {
+		r.warnRestart(c)
+	}
+	r.cur = c
+	return nil
+}
+
+// policyChanges describes how the policies of the store have to change
+// to match a configuration.
+type policyChanges struct {
+	// del are the identifiers of the policies to remove.
+	del []string
+	// add are the policies to add.
+	add []store.Policy
+	// update are the changed policies, which replace in place the
+	// ones with the same identifier.
+	update []store.Policy
+	// replaced maps the identifiers of the policies of other issuers
+	// that are replaced by the ones of the configuration to their issuer.
+	replaced map[string]string
+}
+
+// policiesDiff returns the changes that make the policies issued by the
+// configuration match the ones of `c`: the policies no longer present are
+// removed, the changed ones are updated and the new ones are added. A policy
+// of `c` whose identifier is taken by a policy of another issuer, such as one
+// restored from the policies file or added through the API, replaces it.
+func (r *reloader) policiesDiff(c *config.Config) (policyChanges, error) {
+	ch := policyChanges{replaced: make(map[string]string)}
+	old := make(map[string]store.PolicyRecord)
+	others := make(map[string]string)
+	for _, p := range r.store.GetPoliciesSnapshot() {
+		rec, ok := store.MakePolicyRecord(p)
+		switch {
+		case ok && rec.Issuer == config.Issuer:
+			old[p.ID()] = rec
+		case ok:
+			others[p.ID()] = rec.Issuer
+		}
+	}
+
+	cur := make(map[string]bool, len(c.Policies))
+	for _, v := range c.Policies {
+		rec := v.Record()
+		p, err := r.store.MakePolicy(rec)
+		if err != nil {
+			return ch, err
+		}
+		cur[p.ID()] = true
+
+		// Compare the records of the policies, as the store does not
+		// keep the fields that the policy does not use, and normalizes
+		// some others.
+		if norm, ok := store.MakePolicyRecord(p); ok {
+			rec = norm
+		}
+		if o, ok := old[p.ID()]; ok {
+			if !reflect.DeepEqual(o, rec) {
+				ch.update = append(ch.update, p)
+			}
+			continue
+		}
+		if issuer, ok := others[p.ID()]; ok {
+			ch.del = append(ch.del, p.ID())
+			ch.replaced[p.ID()] = issuer
+		}
+		ch.add = append(ch.add, p)
+	}
+	for id := range old {
+		if !cur[id] {
+			ch.del = append(ch.del, id)
+		}
+	}
+	return ch, nil
+}
+
+// warnRestart logs the changes that cannot be applied while the server
+// is running.
+func (r *reloader) warnRestart(c *config.Config) {
+	changed := func(field string, old, cur interface{}) {
+		if !reflect.DeepEqual(old, cur) {
+			log.Error.Printf("Config: %s changed from %v to %v, restart required to apply it", field, old, cur)
+		}
+	}
+	changed("proxy_port", r.cur.ProxyPort, c.ProxyPort)
+	changed("api_port", r.cur.APIPort, c.APIPort)
+	changed("dial_timeout", r.cur.DialTimeout, c.DialTimeout)
+	changed("policies_file", r.cur.PoliciesFile, c.PoliciesFile)
+	changed("usage_file", r.cur.UsageFile, c.UsageFile)
+	changed("audit_file", r.cur.AuditFile, c.AuditFile)
+	changed("health_check", r.cur.HealthCheck, c.HealthCheck)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/booster-proj/booster/config"
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/source"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestReloader(t *testing.T) {
+	parse := func(data string) *config.Config {
+		c, err := config.Parse("booster.yml", []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	filter, err := source.NewFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := store.New(new(core.Balancer))
+	rl := &reloader{store: rs, filter: filter}
+
+	base := `
+policies:
+  - type: reserve
+    source: eth0
+    hosts: ["example.com"]
+    ports: ["443"]
+  - type: avoid
+    source: wwan0
+    address: "example.org:443"
+  - type: block
+    source: wwan1
+`
+	if err := rl.apply(parse(base)); err != nil {
+		t.Fatal(err)
+	}
+	manual := store.NewBlockPolicy("api", "wwan2")
+	if err := rs.AppendPolicy(manual); err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[string]store.Policy)
+	for _, p := range rs.GetPoliciesSnapshot() {
+		before[p.ID()] = p
+	}
+
+	// Reloading the same configuration does not touch the policies,
+	// even the ones whose fields are normalized by the store.
+	ch, err := rl.policiesDiff(parse(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.del) != 0 || len(ch.add) != 0 || len(ch.update) != 0 {
+		t.Fatalf("Unexpected diff of the same configuration: %+v", ch)
+	}
+
+	changed := `
+policies:
+  - type: reserve
+    source: eth0
+    hosts: ["example.com", "example.net"]
+  - type: avoid
+    source: wwan0
+    address: "example.org:443"
+`
+	if err := rl.apply(parse(changed)); err != nil {
+		t.Fatal(err)
+	}
+	after := make(map[string]store.Policy)
+	pos := make(map[string]int)
+	for i, p := range rs.GetPoliciesSnapshot() {
+		after[p.ID()] = p
+		pos[p.ID()] = i
+	}
+	if len(after) != 3 {
+		t.Fatalf("Unexpected policies: %v", after)
+	}
+	if after["reserve_eth0"] == before["reserve_eth0"] {
+		t.Fatal("Changed policy should be replaced")
+	}
+	if pos["reserve_eth0"] > pos[manual.ID()] {
+		t.Fatalf("Changed policy should keep its position: %v", pos)
+	}
+	for _, id := range []string{"avoid_wwan0_for_example.org", manual.ID()} {
+		if after[id] == nil || after[id] != before[id] {
+			t.Fatalf("Policy %s should be kept: %v", id, after)
+		}
+	}
+	if rl.cur == nil || len(rl.cur.Policies) != 2 {
+		t.Fatalf("Unexpected current configuration: %+v", rl.cur)
+	}
+}
+
+func TestReloader_collision(t *testing.T) {
+	filter, err := source.NewFilter(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := store.New(new(core.Balancer))
+	rl := &reloader{store: rs, filter: filter}
+
+	// Policies restored from the policies file or added through the
+	// API may have the identifier of a policy of the configuration.
+	if err := rs.AppendPolicy(store.NewBlockPolicy("api", "wwan1")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.Parse("booster.yml", []byte(`
+policies:
+  - type: block
+    source: wwan1
+    reason: metered
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.apply(c); err != nil {
+		t.Fatal(err)
+	}
+
+	pl := rs.GetPoliciesSnapshot()
+	if len(pl) != 1 {
+		t.Fatalf("Unexpected policies: %v", pl)
+	}
+	rec, _ := store.MakePolicyRecord(pl[0])
+	if rec.Issuer != config.Issuer || rec.Reason != "metered" {
+		t.Fatalf("The policy of the configuration should replace the other one: %+v", rec)
+	}
+}
@@ -19,14 +19,19 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/booster-proj/booster/config"
 	"github.com/booster-proj/booster/core"
 	"github.com/booster-proj/booster/dialer"
 	"github.com/booster-proj/booster/metrics"
 	"github.com/booster-proj/booster/remote"
+	"github.com/booster-proj/booster/socks5"
 	"github.com/booster-proj/booster/source"
 	"github.com/booster-proj/booster/store"
-	"github.com/booster-proj/proxy"
 	"github.com/grandcat/zeroconf"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -39,6 +44,20 @@ var (
 
 	// API configuration
 	apiPort int
+
+	// Balancer configuration
+	strategy string
+
+	// Dialer configuration
+	dialTimeout time.Duration
+
+	// Store configuration
+	policiesFile string
+	usageFile    string
+	auditFile    string
+
+	// Configuration file
+	configFile string
 )
 
 // serverCmd represents the server command
@@ -46,19 +65,86 @@ var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start a booster server in the foreground",
 	Run: func(cmd *cobra.Command, args []string) {
-		p, err := proxy.NewSOCKS5()
+		p := socks5.New()
+
+		c, err := loadConfig(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		source.PollInterval = c.HealthCheck.PollInterval
+		source.PollTimeout = c.HealthCheck.PollTimeout
 
 		b := new(core.Balancer)
+		if err := b.UseStrategy(c.Strategy); err != nil {
+			log.Fatal(err)
+		}
 		rs := store.New(b)
+		if c.PoliciesFile != "" {
+			if err := makeStateDir(c.PoliciesFile); err != nil {
+				log.Fatal(err)
+			}
+			if err := rs.PersistPolicies(c.PoliciesFile); err != nil {
+				log.Fatal(err)
+			}
+			log.Info.Printf("Policies persisted in %s", c.PoliciesFile)
+		}
+		if c.UsageFile != "" {
+			if err := makeStateDir(c.UsageFile); err != nil {
+				log.Fatal(err)
+			}
+			if err := rs.PersistUsage(c.UsageFile); err != nil {
+				log.Fatal(err)
+			}
+			log.Info.Printf("Usage counters persisted in %s", c.UsageFile)
+		}
+		if c.AuditFile != "" {
+			if err := makeStateDir(c.AuditFile); err != nil {
+				log.Fatal(err)
+			}
+			if err := rs.PersistAudit(c.AuditFile); err != nil {
+				log.Fatal(err)
+			}
+			log.Info.Printf("Policy changes recorded in %s", c.AuditFile)
+		}
+		filter, err := source.NewFilter(c.Interfaces.Include, c.Interfaces.Exclude)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rl := &reloader{
+			load:   func() (*config.Config, error) { return loadConfig(cmd) },
+			store:  rs,
+			filter: filter,
+		}
+		if err := rl.apply(c); err != nil {
+			log.Fatalf("Config: unable to apply policies: %v", err)
+		}
 		exp := new(metrics.Exporter)
+		b.OnBreakerStateChange = func(id string, s core.BreakerState) {
+			log.Info.Printf("Balancer: circuit breaker of source %s is now %v", id, s)
+			exp.SetBreakerState(map[string]string{"source": id}, int(s))
+		}
+		rs.OnQuotaUpdate = func(s store.QuotaStatus) {
+			exp.SetQuota(map[string]string{"source": s.SourceID}, s.Used, s.Remaining)
+		}
+		rs.OnBindHistoryEvent = func(event string) {
+			exp.IncBindHistoryEvent(map[string]string{"event": event})
+		}
 		l := source.NewListener(source.Config{
 			Store:           rs,
 			MetricsExporter: exp,
+			OnDataFlow: func(ref string, data *source.DataFlow) {
+				dir := core.Download
+				if data.Type == "write" {
+					dir = core.Upload
+				}
+				b.AddTransfer(ref, dir, data.N)
+				rs.AddUsage(ref, data.N)
+			},
+			Filter:       filter,
+			CheckTargets: c.HealthCheck.Targets,
 		})
 		d := dialer.New(rs)
+		d.Timeout = c.DialTimeout
 		d.SetMetricsExporter(exp)
 
 		router := remote.NewRouter()
@@ -68,7 +154,7 @@ var serverCmd = &cobra.Command{
 			Version:   Version,
 			Commit:    Commit,
 			BuildTime: BuildTime,
-			ProxyPort: pPort,
+			ProxyPort: c.ProxyPort,
 		}
 
 		router.SetupRoutes()
@@ -81,35 +167,48 @@ var serverCmd = &cobra.Command{
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
-		captureSignals(cancel)
+		captureSignals(cancel, func() {
+			if configFile == "" {
+				log.Info.Printf("Config: no configuration file to reload")
+				return
+			}
+			if err := rl.Reload(); err != nil {
+				log.Error.Printf("Config: reload failed, keeping the old configuration: %v", err)
+				return
+			}
+			log.Info.Printf("Config: reloaded from %s", configFile)
+		})
 
 		// Expose out services as mDNS entries
-		s, err := zeroconf.Register("booster api", "_http._tcp", "local.", apiPort, []string{
+		s, err := zeroconf.Register("booster api", "_http._tcp", "local.", c.APIPort, []string{
 			"Version=" + Version,
 			"Commit=" + Commit,
 		}, nil)
 		defer s.Shutdown()
 
-		s, err = zeroconf.Register("booster proxy", "_SOCKS5_tcp", "local.", pPort, []string{
+		s, err = zeroconf.Register("booster proxy", "_SOCKS5_tcp", "local.", c.ProxyPort, []string{
 			"Version=" + Version,
 			"Commit=" + Commit,
 		}, nil)
 		defer s.Shutdown()
 
+		g.Go(func() error {
+			return rs.Run(ctx)
+		})
 		g.Go(func() error {
 			log.Info.Printf("Listener started")
 			defer log.Info.Printf("Listener stopped.")
 			return l.Run(ctx)
 		})
 		g.Go(func() error {
-			log.Info.Printf("Booster proxy (%v) listening on :%d", p.Protocol(), pPort)
+			log.Info.Printf("Booster proxy (%v) listening on :%d", p.Protocol(), c.ProxyPort)
 			defer log.Info.Print("Booster proxy stopped.")
-			return p.ListenAndServe(ctx, pPort)
+			return p.ListenAndServe(ctx, c.ProxyPort)
 		})
 		g.Go(func() error {
-			log.Info.Printf("Booster API listening on :%d", apiPort)
+			log.Info.Printf("Booster API listening on :%d", c.APIPort)
 			defer log.Info.Print("Booster API stopped.")
-			return r.ListenAndServe(ctx, apiPort)
+			return r.ListenAndServe(ctx, c.APIPort)
 		})
 
 		if err := g.Wait(); err != nil {
@@ -121,19 +220,99 @@ var serverCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	// Configuration file
+	serverCmd.Flags().StringVar(&configFile, "config", "", "YAML configuration file, flags explicitly set take precedence over its values")
+
 	// Proxy configuration
 	serverCmd.Flags().IntVar(&pPort, "proxy-port", 1080, "Proxy server listening port")
 
 	// API configuration
 	serverCmd.Flags().IntVar(&apiPort, "api-port", 7764, "API server listening port")
+
+	// Dialer configuration
+	serverCmd.Flags().DurationVar(&dialTimeout, "dial-timeout", time.Second*5, "Maximum duration of a single dial attempt, 0 means no timeout")
+
+	// Balancer configuration
+	serverCmd.Flags().StringVar(&strategy, "strategy", core.DefaultStrategy, "Balancing strategy, one of: "+strings.Join(core.Strategies(), ", "))
+
+	// Store configuration
+	serverCmd.Flags().StringVar(&policiesFile, "policies-file", defaultStateFile("policies.json"), "File where policies are saved and restored from, empty disables persistence")
+	serverCmd.Flags().StringVar(&usageFile, "usage-file", defaultStateFile("usage.json"), "File where the data usage of each source is saved and restored from, empty disables persistence")
+	serverCmd.Flags().StringVar(&auditFile, "audit-file", defaultStateFile("audit.log"), "File where policy changes are recorded, empty disables the audit log")
+}
+
+// defaultStateFile returns the default location of the state file
+// `name`, which is inside the writable data directory when running
+// as a snap, and inside the booster directory of the user configuration
+// directory otherwise, e.g. ~/.config/booster on Linux. It returns
+// none if the configuration directory is not known.
+func defaultStateFile(name string) string {
+	if dir := os.Getenv("SNAP_DATA"); dir != "" {
+		return filepath.Join(dir, name)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "booster", name)
+}
+
+// makeStateDir creates the directory of the state file at `path`,
+// if it does not exist yet.
+func makeStateDir(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
+
+// loadConfig loads the configuration file, if provided, and overrides its
+// values with the flags explicitly set on the command line. Without a
+// configuration file, the flags and their defaults are used.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	c := config.Default()
+	if configFile != "" {
+		var err error
+		if c, err = config.Load(configFile); err != nil {
+			return nil, err
+		}
+		log.Info.Printf("Configuration loaded from %s", configFile)
+	}
+
+	flags := cmd.Flags()
+	if configFile == "" || flags.Changed("proxy-port") {
+		c.ProxyPort = pPort
+	}
+	if configFile == "" || flags.Changed("api-port") {
+		c.APIPort = apiPort
+	}
+	if configFile == "" || flags.Changed("strategy") {
+		c.Strategy = strategy
+	}
+	if configFile == "" || flags.Changed("dial-timeout") {
+		c.DialTimeout = dialTimeout
+	}
+	if c.PoliciesFile == "" || flags.Changed("policies-file") {
+		c.PoliciesFile = policiesFile
+	}
+	if c.UsageFile == "" || flags.Changed("usage-file") {
+		c.UsageFile = usageFile
+	}
+	if c.AuditFile == "" || flags.Changed("audit-file") {
+		c.AuditFile = auditFile
+	}
+	return c, nil
 }
 
-func captureSignals(cancel context.CancelFunc) {
+// captureSignals calls `reload` each time SIGHUP is received, and
+// `cancel` on the other signals.
+func captureSignals(cancel context.CancelFunc, reload func()) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
+	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGHUP)
 
 	go func() {
-		for range c {
+		for sig := range c {
+			if sig == syscall.SIGHUP {
+				reload()
+				continue
+			}
 			cancel()
 		}
 	}()
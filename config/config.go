@@ -0,0 +1,443 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package config defines the configuration file of a booster server.
+// The file is written in YAML, and describes the ports the server listens
+// on, the balancing strategy, which network interfaces should be used
+// and how they are checked, and an initial set of policies. Invalid files
+// are rejected with errors that point to the offending line.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/source"
+	"github.com/booster-proj/booster/store"
+	"gopkg.in/yaml.v3"
+)
+
+// Issuer is the issuer of the policies created from a configuration file.
+const Issuer = "config"
+
+// Config is the configuration of a booster server.
+type Config struct {
+	ProxyPort    int           `yaml:"proxy_port"`
+	APIPort      int           `yaml:"api_port"`
+	Strategy     string        `yaml:"strategy"`
+	DialTimeout  time.Duration `yaml:"dial_timeout"`
+	PoliciesFile string        `yaml:"policies_file"`
+	UsageFile    string        `yaml:"usage_file"`
+	AuditFile    string        `yaml:"audit_file"`
+
+	Interfaces  Interfaces  `yaml:"interfaces"`
+	HealthCheck HealthCheck `yaml:"health_check"`
+	Policies    []Policy    `yaml:"policies"`
+}
+
+// Interfaces contains the patterns used to select the network interfaces
+// that booster may use, see source.Filter.
+type Interfaces struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// HealthCheck describes how often the network interfaces are inspected,
+// and which addresses are dialed to check their internet connection.
+type HealthCheck struct {
+	Targets      []string      `yaml:"targets"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	PollTimeout  time.Duration `yaml:"poll_timeout"`
+}
+
+// Policy types accepted in the configuration file.
+const (
+	PolicyBlock   = "block"
+	PolicyReserve = "reserve"
+	PolicyAvoid   = "avoid"
+	PolicySticky  = "sticky"
+	PolicyRoute   = "route"
+	PolicyQuota   = "quota"
+)
+
+var policyCodes = map[string]int{
+	PolicyBlock:   store.PolicyCodeBlock,
+	PolicyReserve: store.PolicyCodeReserve,
+	PolicyAvoid:   store.PolicyCodeAvoid,
+	PolicySticky:  store.PolicyCodeStick,
+	PolicyRoute:   store.PolicyCodeRoute,
+	PolicyQuota:   store.PolicyCodeQuota,
+}
+
+// Policy describes a policy that should be applied when the server starts.
+type Policy struct {
+	Type    string   `yaml:"type"`
+	Source  string   `yaml:"source"`
+	Hosts   []string `yaml:"hosts"`
+	Address string   `yaml:"address"`
+	Network string   `yaml:"network"`
+	Ports   []string `yaml:"ports"`
+	Clients []string `yaml:"clients"`
+	Reason  string   `yaml:"reason"`
+
+	// ExpiresAt and Window limit the time in which the
+	// policy is in effect, see store.TimeBound.
+	ExpiresAt *time.Time `yaml:"expires_at"`
+	Window    string     `yaml:"window"`
+
+	// Budget is the amount of data allowed in each billing period
+	// by a quota policy, such as "20GB" or "512MiB". ResetDay is
+	// the day of the month in which the period starts.
+	Budget   string `yaml:"budget"`
+	ResetDay int    `yaml:"reset_day"`
+
+	// Priority and Effect tell in which order the policy is
+	// evaluated and what it does to the connections it matches,
+	// see store.Ranked. Effect is either "allow" or "deny".
+	Priority int    `yaml:"priority"`
+	Effect   string `yaml:"effect"`
+}
+
+// Record returns the representation of `p` that the store is able to
+// turn into a policy.
+func (p Policy) Record() store.PolicyRecord {
+	r := store.PolicyRecord{
+		Code:     policyCodes[p.Type],
+		Issuer:   Issuer,
+		Reason:   p.Reason,
+		SourceID: p.Source,
+		Hosts:    p.Hosts,
+		Address:  p.Address,
+		Network:  p.Network,
+		Clients:  p.Clients,
+		ResetDay: p.ResetDay,
+		Priority: p.Priority,
+	}
+	// The effect is checked when the configuration is parsed.
+	r.Effect, _ = store.ParseEffect(p.Effect)
+	if p.Budget != "" {
+		// The budget is checked when the configuration is parsed.
+		r.Budget, _ = ParseSize(p.Budget)
+	}
+	for _, v := range p.Ports {
+		// Ports are checked when the configuration is parsed.
+		pr, _ := store.ParsePortRange(v)
+		r.Ports = append(r.Ports, pr)
+	}
+	if p.ExpiresAt != nil {
+		at := p.ExpiresAt.UTC()
+		r.ExpiresAt = &at
+	}
+	if p.Window != "" {
+		w, _ := store.ParseWindow(p.Window)
+		r.Window = &w
+	}
+	return r
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// ParseSize parses an amount of data such as "20GB", "1.5 GiB" or "1024",
+// returning it in bytes. Units are case insensitive.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// Default returns the configuration used when no file is provided.
+func Default() *Config {
+	return &Config{
+		ProxyPort:   1080,
+		APIPort:     7764,
+		Strategy:    core.DefaultStrategy,
+		DialTimeout: time.Second * 5,
+		HealthCheck: HealthCheck{
+			Targets:      append([]string{}, source.DefaultCheckTargets...),
+			PollInterval: source.PollInterval,
+			PollTimeout:  source.PollTimeout,
+		},
+	}
+}
+
+// Error describes a problem found at a specific line of a configuration file.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ErrorList is the list of errors found in a configuration file.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	acc := make([]string, len(l))
+	for i, v := range l {
+		acc[i] = v.Error()
+	}
+	return strings.Join(acc, "\n")
+}
+
+// Load reads and parses the configuration file at `path`.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	return Parse(path, data)
+}
+
+// Parse parses and validates the configuration contained in `data`. Fields
+// that are not present take their value from Default. `name` is used to
+// refer to the file in the errors returned, which are of type ErrorList.
+func Parse(name string, data []byte) (*Config, error) {
+	c := Default()
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, ErrorList{yamlError(name, err)}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		if terr, ok := err.(*yaml.TypeError); ok {
+			acc := make(ErrorList, 0, len(terr.Errors))
+			for _, v := range terr.Errors {
+				acc = append(acc, yamlError(name, fmt.Errorf("yaml: %s", v)))
+			}
+			return nil, acc
+		}
+		return nil, ErrorList{yamlError(name, err)}
+	}
+
+	v := &validator{file: name, root: &root}
+	v.validate(c)
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	return c, nil
+}
+
+// yamlError converts errors returned by the yaml package, which look like
+// "yaml: line 3: some message", into Errors.
+func yamlError(name string, err error) *Error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	var line int
+	if n, _ := fmt.Sscanf(msg, "line %d:", &line); n == 1 {
+		msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+	}
+	return &Error{File: name, Line: line, Msg: msg}
+}
+
+type validator struct {
+	file string
+	root *yaml.Node
+	errs ErrorList
+}
+
+// errorf records an error, pointing it to the line of the node found
+// following `path` from the root of the document. Elements of `path`
+// are either mapping keys or sequence indexes.
+func (v *validator) errorf(path []interface{}, format string, args ...interface{}) {
+	v.errs = append(v.errs, &Error{
+		File: v.file,
+		Line: lineOf(v.root, path...),
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+func lineOf(n *yaml.Node, path ...interface{}) int {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for _, p := range path {
+		var next *yaml.Node
+		switch k := p.(type) {
+		case string:
+			if n.Kind != yaml.MappingNode {
+				break
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == k {
+					next = n.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if n.Kind == yaml.SequenceNode && k < len(n.Content) {
+				next = n.Content[k]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n.Line
+}
+
+func (v *validator) validate(c *Config) {
+	for _, p := range []struct {
+		key  string
+		port int
+	}{{"proxy_port", c.ProxyPort}, {"api_port", c.APIPort}} {
+		if p.port <= 0 || p.port > 65535 {
+			v.errorf(at(p.key), "invalid port %d", p.port)
+		}
+	}
+	if c.ProxyPort == c.APIPort {
+		v.errorf(at("api_port"), "api_port and proxy_port cannot be the same")
+	}
+
+	strategies := core.Strategies()
+	if i := sort.SearchStrings(strategies, c.Strategy); i == len(strategies) || strategies[i] != c.Strategy {
+		v.errorf(at("strategy"), "unknown strategy %q, available: %s", c.Strategy, strings.Join(strategies, ", "))
+	}
+	if c.DialTimeout < 0 {
+		v.errorf(at("dial_timeout"), "dial_timeout cannot be negative")
+	}
+
+	for _, key := range []string{"include", "exclude"} {
+		patterns := c.Interfaces.Include
+		if key == "exclude" {
+			patterns = c.Interfaces.Exclude
+		}
+		for i, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				v.errorf(at("interfaces", key, i), "invalid pattern %q: %v", p, err)
+			}
+		}
+	}
+
+	hc := c.HealthCheck
+	if len(hc.Targets) == 0 {
+		v.errorf(at("health_check", "targets"), "at least one health check target is required")
+	}
+	for i, t := range hc.Targets {
+		if _, _, err := net.SplitHostPort(t); err != nil {
+			v.errorf(at("health_check", "targets", i), "invalid target %q, expected host:port", t)
+		}
+	}
+	if hc.PollInterval <= 0 {
+		v.errorf(at("health_check", "poll_interval"), "poll_interval must be positive")
+	}
+	if hc.PollTimeout <= 0 {
+		v.errorf(at("health_check", "poll_timeout"), "poll_timeout must be positive")
+	}
+
+	seen := make(map[string]bool, len(c.Policies))
+	for i, p := range c.Policies {
+		v.validatePolicy(i, p, seen)
+	}
+}
+
+func (v *validator) validatePolicy(i int, p Policy, seen map[string]bool) {
+	base := at("policies", i)
+	if _, ok := policyCodes[p.Type]; !ok {
+		v.errorf(append(base, "type"), "unknown policy type %q, expected one of: block, reserve, avoid, sticky, route, quota", p.Type)
+		return
+	}
+
+	// Check the fields that Record converts first, as it drops the
+	// values it is not able to convert, then let the store check the
+	// policy it would create.
+	valid := true
+	if p.Budget != "" {
+		if _, err := ParseSize(p.Budget); err != nil {
+			v.errorf(append(base, "budget"), "%v", err)
+			valid = false
+		}
+	}
+	for j, pr := range p.Ports {
+		if _, err := store.ParsePortRange(pr); err != nil {
+			v.errorf(append(base, "ports", j), "%v", err)
+			valid = false
+		}
+	}
+	if _, err := store.ParseEffect(p.Effect); err != nil {
+		v.errorf(append(base, "effect"), "%v", err)
+		valid = false
+	}
+	if p.Window != "" {
+		if _, err := store.ParseWindow(p.Window); err != nil {
+			v.errorf(append(base, "window"), "%v", err)
+			valid = false
+		}
+	}
+	if valid {
+		if err := p.Record().Validate(); err != nil {
+			v.errorf(base, "%v", err)
+		}
+	}
+
+	// Policies are identified by their type, source and targets,
+	// see the store package.
+	key := p.Type + "/" + p.Source
+	switch p.Type {
+	case PolicyAvoid:
+		key += "/" + store.TrimPort(p.Address) + "/" + p.Network + "/" + strings.Join(p.Ports, ",") + "/" + strings.Join(p.Clients, ",")
+	case PolicyRoute:
+		key += "/" + strings.Join(p.Hosts, ",") + "/" + p.Network + "/" + strings.Join(p.Ports, ",") + "/" + strings.Join(p.Clients, ",")
+	}
+	if seen[key] {
+		v.errorf(base, "duplicate %s policy", p.Type)
+	}
+	seen[key] = true
+}
+
+func at(elems ...interface{}) []interface{} {
+	return elems
+}
@@ -0,0 +1,239 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package config_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/config"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestParse(t *testing.T) {
+	data := `
+proxy_port: 1081
+strategy: least-connections
+interfaces:
+  exclude: ["docker*"]
+health_check:
+  targets: ["example.com:443"]
+  poll_interval: 10s
+policies:
+  - type: block
+    source: wwan0
+    reason: metered
+  - type: reserve
+    source: eth0
+    hosts: ["steamcontent.com"]
+    window: "01:00-05:00"
+    expires_at: 2030-01-02T15:04:05Z
+  - type: sticky
+  - type: route
+    source: eth0
+    network: udp
+    ports: ["27000-27100"]
+    clients: ["192.168.1.0/24"]
+  - type: quota
+    source: wwan0
+    budget: 20GB
+    reset_day: 5
+    hosts: ["*.example.com"]
+  - type: avoid
+    source: wwan0
+    address: example.com
+    priority: 10
+    effect: allow
+`
+	c, err := config.Parse("booster.yml", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ProxyPort != 1081 {
+		t.Fatalf("Unexpected proxy port: %d", c.ProxyPort)
+	}
+	if c.APIPort != config.Default().APIPort {
+		t.Fatalf("API port should take its default value, found %d", c.APIPort)
+	}
+	if c.HealthCheck.PollInterval != 10*time.Second {
+		t.Fatalf("Unexpected poll interval: %v", c.HealthCheck.PollInterval)
+	}
+	if c.HealthCheck.PollTimeout != config.Default().HealthCheck.PollTimeout {
+		t.Fatalf("Poll timeout should take its default value, found %v", c.HealthCheck.PollTimeout)
+	}
+	if len(c.Policies) != 6 {
+		t.Fatalf("Unexpected number of policies: %d", len(c.Policies))
+	}
+
+	r := c.Policies[0].Record()
+	if r.Code != store.PolicyCodeBlock || r.SourceID != "wwan0" || r.Issuer != config.Issuer || r.Reason != "metered" {
+		t.Fatalf("Unexpected policy record: %+v", r)
+	}
+	r = c.Policies[1].Record()
+	if r.Window == nil || r.Window.String() != "01:00-05:00" {
+		t.Fatalf("Unexpected policy window: %v", r.Window)
+	}
+	if r.ExpiresAt == nil || !r.ExpiresAt.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatalf("Unexpected policy expiration: %v", r.ExpiresAt)
+	}
+	r = c.Policies[3].Record()
+	if r.Code != store.PolicyCodeRoute || r.Network != "udp" || len(r.Ports) != 1 || r.Ports[0] != (store.PortRange{From: 27000, To: 27100}) || len(r.Clients) != 1 {
+		t.Fatalf("Unexpected policy record: %+v", r)
+	}
+	r = c.Policies[5].Record()
+	if r.Priority != 10 || r.Effect != store.EffectAllow {
+		t.Fatalf("Unexpected policy rank: %d, %s", r.Priority, r.Effect)
+	}
+	r = c.Policies[4].Record()
+	if r.Code != store.PolicyCodeQuota || r.Budget != 20e9 || r.ResetDay != 5 || len(r.Hosts) != 1 {
+		t.Fatalf("Unexpected policy record: %+v", r)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tt := []struct {
+		data string
+		errs []string
+	}{
+		{
+			data: "proxy_port: 1080\nproxy_prot: 1081\n",
+			errs: []string{"booster.yml:2: field proxy_prot not found"},
+		},
+		{
+			data: "proxy_port: foo\n",
+			errs: []string{"booster.yml:1: cannot unmarshal"},
+		},
+		{
+			data: "api_port: 7764\n  strategy: [\n",
+			errs: []string{"booster.yml:2:"},
+		},
+		{
+			data: "api_port: 70000\nstrategy: fastest\n",
+			errs: []string{
+				"booster.yml:1: invalid port 70000",
+				"booster.yml:2: unknown strategy \"fastest\"",
+			},
+		},
+		{
+			data: "interfaces:\n  include:\n    - eth0\n    - \"[\"\n",
+			errs: []string{"booster.yml:4: invalid pattern"},
+		},
+		{
+			data: "policies:\n  - type: reserve\n    source: eth0\n    hosts:\n      - \"10.0.0.0/33\"\n      - \"steam*.com\"\n",
+			errs: []string{"booster.yml:2: invalid CIDR range"},
+		},
+		{
+			data: "policies:\n  - type: avoid\n    source: wwan0\n    network: sctp\n  - type: avoid\n    source: wwan0\n    ports: [\"443\", \"100-10\"]\n  - type: route\n    source: eth0\n",
+			errs: []string{
+				"booster.yml:2: invalid network \"sctp\"",
+				"booster.yml:7: invalid port range \"100-10\"",
+				"booster.yml:8: route policy requires some hosts, a network, some ports or some clients",
+			},
+		},
+		{
+			data: "policies:\n  - type: route\n    source: wwan0\n    clients: [\"192.168.1.50\", \"192.168.1\"]\n",
+			errs: []string{"booster.yml:2: invalid client"},
+		},
+		{
+			data: "policies:\n  - type: block\n    source: wwan0\n    window: \"25:00-05:00\"\n",
+			errs: []string{"booster.yml:4: invalid window"},
+		},
+		{
+			data: "policies:\n  - type: quota\n    source: wwan0\n  - type: quota\n    source: wwan1\n    budget: 20XB\n  - type: quota\n    source: wwan2\n    budget: 20GB\n    reset_day: 31\n",
+			errs: []string{
+				"booster.yml:2: budget must be positive",
+				"booster.yml:6: invalid size \"20XB\"",
+				"booster.yml:7: reset_day must be between 1 and 28",
+			},
+		},
+		{
+			data: "policies:\n  - type: reserve\n    source: eth0\n    hosts: [example.com]\n    effect: allow\n  - type: block\n    source: wwan0\n    effect: permit\n",
+			errs: []string{
+				"booster.yml:2: reserve policy does not support the allow effect",
+				"booster.yml:8: invalid effect \"permit\"",
+			},
+		},
+		{
+			data: "health_check:\n  targets: [google.com]\n",
+			errs: []string{"booster.yml:2: invalid target \"google.com\""},
+		},
+		{
+			data: `policies:
+  - type: block
+    source: wwan0
+  - type: reserve
+    source: eth0
+  - type: blok
+    source: eth0
+  - type: block
+    source: wwan0
+`,
+			errs: []string{
+				"booster.yml:4: reserve policy requires at least one host",
+				"booster.yml:6: unknown policy type \"blok\"",
+				"booster.yml:8: duplicate block policy",
+			},
+		},
+	}
+
+	for i, v := range tt {
+		_, err := config.Parse("booster.yml", []byte(v.data))
+		if err == nil {
+			t.Fatalf("%d: Parse should fail", i)
+		}
+		list, ok := err.(config.ErrorList)
+		if !ok {
+			t.Fatalf("%d: Unexpected error type %T", i, err)
+		}
+		if len(list) != len(v.errs) {
+			t.Fatalf("%d: Unexpected errors: wanted %d, found %d: %v", i, len(v.errs), len(list), err)
+		}
+		for j, e := range list {
+			if !strings.HasPrefix(e.Error(), v.errs[j]) {
+				t.Fatalf("%d: Unexpected error: wanted prefix \"%s\", found \"%v\"", i, v.errs[j], e)
+			}
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tt := []struct {
+		in  string
+		out int64
+	}{
+		{"1024", 1024},
+		{"20GB", 20e9},
+		{"512MiB", 512 << 20},
+		{"1.5 gib", 3 << 29},
+		{"10kb", 10000},
+	}
+	for i, v := range tt {
+		n, err := config.ParseSize(v.in)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if n != v.out {
+			t.Fatalf("%d: Unexpected size: wanted %d, found %d", i, v.out, n)
+		}
+	}
+	for i, v := range []string{"", "GB", "10XB", "1.2.3MB"} {
+		if _, err := config.ParseSize(v); err == nil {
+			t.Fatalf("%d: ParseSize(%q) should fail", i, v)
+		}
+	}
+}
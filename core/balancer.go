@@ -20,8 +20,11 @@ package core
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Dialer is a wrapper around the DialContext function.
@@ -43,97 +46,251 @@ type Source interface {
 	Close() error
 }
 
-// Strategy chooses a source from a ring of sources.
-type Strategy func(ctx context.Context, r *Ring) (Source, error)
+// Strategy chooses a source from a list of sources, that will be used
+// to dial a connection to target. Strategies must not modify ss, which
+// is shared with other goroutines, and must be safe to be used by
+// multiple goroutines, as the balancer does not serialize its calls.
+// Stateful strategies should leave their state untouched when ctx is
+// marked with WithDryRun.
+type Strategy func(ctx context.Context, target string, ss []Source) (Source, error)
+
+// RoundRobin returns a naive strategy that iterates and returns each
+// element contained in the list of sources it receives.
+func RoundRobin() Strategy {
+	var cursor uint64
+	return func(ctx context.Context, target string, ss []Source) (Source, error) {
+		if len(ss) == 0 {
+			return nil, errors.New("round robin: no source available")
+		}
+		return ss[next(ctx, &cursor, len(ss))], nil
+	}
+}
 
-// RoundRobin is a naive strategy that iterates and returns each element contained in r.
-func RoundRobin(ctx context.Context, r *Ring) (Source, error) {
-	defer r.Next()
-	return r.Source(), nil
+// next increments cursor and returns its previous value, modulo n. The
+// cursor is not incremented if ctx is marked with WithDryRun.
+func next(ctx context.Context, cursor *uint64, n int) int {
+	if IsDryRun(ctx) {
+		return int(atomic.LoadUint64(cursor) % uint64(n))
+	}
+	return int((atomic.AddUint64(cursor, 1) - 1) % uint64(n))
+}
+
+// lowest returns the source of ss with the lowest score. Ties are broken
+// using round robin, advancing cursor. ss must not be empty.
+func lowest(ctx context.Context, ss []Source, cursor *uint64, score func(Source) float64) Source {
+	min := score(ss[0])
+	ties := make([]Source, 1, len(ss))
+	ties[0] = ss[0]
+	for _, s := range ss[1:] {
+		switch v := score(s); {
+		case v < min:
+			min = v
+			ties = append(ties[:0], s)
+		case v == min:
+			ties = append(ties, s)
+		}
+	}
+	if len(ties) == 1 {
+		return ties[0]
+	}
+	return ties[next(ctx, cursor, len(ties))]
+}
+
+// sourceSet is an immutable snapshot of the sources stored in
+// the balancer, together with the attributes that Get needs.
+type sourceSet struct {
+	sources  []Source
+	tiers    []int
+	breakers []*Breaker
+
+	// tiered is true if the sources belong to more than one tier.
+	tiered bool
 }
 
 // Balancer distributes work to set of sources, using a particular strategy.
 // The zero value of the Balancer is ready to use and safe to be used by multiple
 // gorountines.
+// The set of sources is an immutable snapshot which is replaced on each
+// update, hence Get, Do and Len never block.
 type Balancer struct {
-	mux sync.Mutex
-	r   *Ring
+	mux sync.Mutex   // serializes the updates of set.
+	set atomic.Value // *sourceSet
+
+	// attrs contains the attributes associated to each source,
+	// identified by its ID. The attributes survive the removal of
+	// the source they refer to, so they are restored if the source
+	// is added again later.
+	attrs struct {
+		sync.RWMutex
+		weights    map[string]int
+		throughput map[string]*throughput
+		tiers      map[string]int
+		breakers   map[string]*Breaker
+	}
 
+	// tripped is the number of circuit breakers that are not closed.
+	tripped int32
+	// tier is the priority tier of the last source returned by Get,
+	// plus one. 0 means that Get did not return any source yet.
+	tier int64
+	// cursor of the default strategy.
+	cursor uint64
+	// named is the strategy set with UseStrategy, which takes
+	// precedence over the Strategy field.
+	named atomic.Value // *namedStrategy
+
+	// Strategy is the strategy used by the balancer, unless one
+	// is selected with UseStrategy. It must not be modified while the
+	// balancer is being used.
 	Strategy
-}
 
-// Get returns a Source from the balancer's source list using the predefined Strategy.
-// If no Strategy was provided, Get returns a Source using RoundRobin.
-func (b *Balancer) Get(ctx context.Context, blacklist ...Source) (Source, error) {
-	b.mux.Lock()
-	defer b.mux.Unlock()
+	// BreakerThreshold and BreakerCooldown configure the circuit
+	// breakers of the sources, see Breaker and ReportDial.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 
-	if b.r == nil {
-		return nil, errors.New("Empty source ring. Use Put to provide at least one source to the balancer")
+	// OnBreakerStateChange, if not nil, is called each time the circuit
+	// breaker of a source changes its state.
+	OnBreakerStateChange func(id string, s BreakerState)
+}
+
+func (b *Balancer) load() *sourceSet {
+	if set, ok := b.set.Load().(*sourceSet); ok {
+		return set
 	}
-	if b.Strategy == nil {
-		b.Strategy = RoundRobin
+	return &sourceSet{}
+}
+
+// update replaces the set of sources with a snapshot containing ss.
+// Must be called while holding b.mux.
+func (b *Balancer) update(ss []Source) {
+	set := &sourceSet{
+		sources:  ss,
+		tiers:    make([]int, len(ss)),
+		breakers: make([]*Breaker, len(ss)),
 	}
-	if len(blacklist) == 0 {
-		return b.Strategy(ctx, b.r)
+	for i, v := range ss {
+		set.tiers[i] = b.Tier(v.ID())
+		set.breakers[i] = b.breaker(v.ID())
+		if set.tiers[i] != set.tiers[0] {
+			set.tiered = true
+		}
 	}
+	b.set.Store(set)
+}
 
-	bl := make(map[string]interface{})
-	for _, v := range blacklist {
-		bl[v.ID()] = nil
+// Get returns a Source from the balancer's source list using the strategy selected
+// with UseStrategy, or the Strategy field. If no strategy was provided, Get returns
+// a Source using round robin. target is the
+// address that the source will be used to connect to, and is forwarded to the Strategy.
+// The sources in blacklist, the ones which circuit breaker is open and the ones that
+// do not belong to the highest priority tier available are not taken into consideration.
+// If the breakers of all the sources not in blacklist are open, the source which breaker
+// opened least recently is returned, so that a failure of the network does not stop the
+// balancer for a whole cooldown period.
+// If ctx is marked with WithDryRun, the state of the balancer is not updated: the
+// circuit breakers are only checked, without allowing any trial request.
+func (b *Balancer) Get(ctx context.Context, target string, blacklist ...Source) (Source, error) {
+	set := b.load()
+	if len(set.sources) == 0 {
+		return nil, errors.New("Empty source set. Use Put to provide at least one source to the balancer")
 	}
 
-	for i := 0; i < b.r.Len(); i++ {
-		s, err := b.Strategy(ctx, b.r)
+	strategy := b.strategy()
+
+	if len(blacklist) == 0 && !set.tiered && atomic.LoadInt32(&b.tripped) == 0 {
+		// Every source is suitable, the strategy can
+		// work directly on the snapshot.
+		s, err := strategy(ctx, target, set.sources)
 		if err != nil {
-			// Avoid retring if the strategy returns an error.
 			return nil, err
 		}
+		if !IsDryRun(ctx) {
+			b.setActiveTier(set.tiers[0])
+		}
+		return s, nil
+	}
+
+	bl := make(map[string]interface{}, len(blacklist))
+	for _, v := range blacklist {
+		bl[v.ID()] = nil
+	}
 
-		// Check if the source is contained in the blacklist.
-		if _, ok := bl[s.ID()]; !ok {
-			return s, nil
+	// Collect the sources that are not blacklisted, keeping only the
+	// ones that belong to the highest priority tier available.
+	l := make([]Source, 0, len(set.sources))
+	tier := -1
+	var fallback Source
+	var fallbackAt time.Time
+	dry, now := IsDryRun(ctx), time.Now()
+	for i, s := range set.sources {
+		if _, ok := bl[s.ID()]; ok {
+			continue
+		}
+		allow := set.breakers[i].allowed(now)
+		if !dry {
+			allow = set.breakers[i].Allow()
+		}
+		if !allow {
+			if at := set.breakers[i].openedAt(); fallback == nil || at.Before(fallbackAt) {
+				fallback, fallbackAt = s, at
+			}
+			continue
 		}
+		switch t := set.tiers[i]; {
+		case tier < 0 || t < tier:
+			tier = t
+			l = append(l[:0], s)
+		case t == tier:
+			l = append(l, s)
+		}
+	}
+	if len(l) == 0 && fallback != nil {
+		return fallback, nil
+	}
+	if len(l) == 0 {
+		return nil, errors.New("balancer: unable to find any suitable source")
 	}
 
-	return nil, errors.New("balancer: unable to find any suitable source")
+	s, err := strategy(ctx, target, l)
+	if err != nil {
+		return nil, err
+	}
+	if !IsDryRun(ctx) {
+		b.setActiveTier(tier)
+	}
+	return s, nil
+}
+
+func (b *Balancer) roundRobin(ctx context.Context, target string, ss []Source) (Source, error) {
+	return ss[next(ctx, &b.cursor, len(ss))], nil
 }
 
-// Put adds ss as sources to the current balancer ring. If ss.len() == 0, Put silently returns,
-// otherwise it constracts a Ring with the provided sources.
-// If the balancer has already a ring, pointing lets say to 0, it adds the ring at position -1,
-// preserving the balancer's ring position.
-// If the balancer does not have a ring yet, the new ring will be used, making it point to
-// the first source provided in the list.
+// Put adds ss as sources to the tail of the balancer's source list. If len(ss) == 0,
+// Put silently returns.
+// The circuit breakers of the sources provided are closed.
 func (b *Balancer) Put(ss ...Source) {
 	if len(ss) == 0 {
 		return
 	}
 
-	b.mux.Lock()
-	defer b.mux.Unlock()
-
-	// Create a new ring containing the new sources.
-	s := NewRingSources(ss...)
-
-	if b.r == nil || b.r.Len() == 0 {
-		// Initialize the ring if it's still empty
-		b.r = s
-		return
+	for _, v := range ss {
+		b.breaker(v.ID()).Success()
 	}
 
-	// Make one step back. We want to keep the current position of the ring,
-	// adding the sources as "tail".
-	r := b.r.Prev()
+	b.mux.Lock()
+	defer b.mux.Unlock()
 
-	// Link the new ring to the old one. The resulting ring will point to the same
-	// position as the original one.
-	b.r = r.Link(s)
+	old := b.load().sources
+	l := make([]Source, 0, len(old)+len(ss))
+	l = append(l, old...)
+	l = append(l, ss...)
+	b.update(l)
 }
 
 // Del removes ss from the list of sources stored by the balancer.
 func (b *Balancer) Del(ss ...Source) {
-	if len(ss) == 0 || b.r == nil {
+	if len(ss) == 0 {
 		return
 	}
 
@@ -146,8 +303,10 @@ func (b *Balancer) Del(ss ...Source) {
 	b.mux.Lock()
 	defer b.mux.Unlock()
 
-	l := make([]Source, 0, b.r.Len())
-	b.r.Do(func(s Source) {
+	old := b.load().sources
+	l := make([]Source, 0, len(old))
+	removed := make([]Source, 0, len(ss))
+	for _, s := range old {
 		// Check if the identifier of this stored source is contained in the map
 		// of sources that have to be removed.
 		if _, ok := m[s.ID()]; !ok {
@@ -155,34 +314,55 @@ func (b *Balancer) Del(ss ...Source) {
 			// list of accepted sources.
 			l = append(l, s)
 		} else {
-			// This source will be removed.
-			s.Close()
+			removed = append(removed, s)
 		}
-	})
+	}
+	b.update(l)
 
-	s := NewRingSources(l...)
-	b.r = s
+	// The sources are closed once they cannot be returned by Get anymore.
+	for _, s := range removed {
+		s.Close()
+	}
 }
 
 // Do executes f on each source stored in the balancer.
 func (b *Balancer) Do(f func(Source)) {
-	b.mux.Lock()
-	defer b.mux.Unlock()
-
-	if b.r == nil {
-		return
+	for _, s := range b.load().sources {
+		f(s)
 	}
-	b.r.Do(f)
 }
 
 // Len reports the size of the set of sources stored in the balancer.
 func (b *Balancer) Len() int {
-	b.mux.Lock()
-	defer b.mux.Unlock()
+	return len(b.load().sources)
+}
+
+// SetWeight associates weight w to the source identified by id. The
+// source does not have to be stored in the balancer. w must be a positive
+// number.
+func (b *Balancer) SetWeight(id string, w int) error {
+	if w < 1 {
+		return fmt.Errorf("balancer: invalid weight %d for source %s: must be greater than 0", w, id)
+	}
 
-	if b.r == nil {
-		return 0
+	b.attrs.Lock()
+	defer b.attrs.Unlock()
+
+	if b.attrs.weights == nil {
+		b.attrs.weights = make(map[string]int)
 	}
+	b.attrs.weights[id] = w
+	return nil
+}
 
-	return b.r.Len()
+// Weight returns the weight associated with the source identified by id.
+// Sources that were not assigned a weight have weight 1.
+func (b *Balancer) Weight(id string) int {
+	b.attrs.RLock()
+	defer b.attrs.RUnlock()
+
+	if w, ok := b.attrs.weights[id]; ok {
+		return w
+	}
+	return 1
 }
@@ -17,6 +17,7 @@ package core_test
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"testing"
 	"time"
@@ -91,7 +92,7 @@ func TestPut_empty(t *testing.T) {
 func TestGet_roundRobin(t *testing.T) {
 	b := &core.Balancer{}
 
-	if _, err := b.Get(context.TODO()); err == nil {
+	if _, err := b.Get(context.TODO(), ""); err == nil {
 		t.Fatal("Unexpected nil error with empty balancer")
 	}
 
@@ -109,7 +110,7 @@ func TestGet_roundRobin(t *testing.T) {
 
 	for i, v := range tt {
 		// Get sources using the default round robin strategy.
-		s, err := b.Get(context.TODO())
+		s, err := b.Get(context.TODO(), "")
 		if err != nil {
 			t.Fatalf("Unexpected error while getting source: %v. %v", i, err)
 		}
@@ -129,12 +130,12 @@ func TestGetBlacklist_roundRobin(t *testing.T) {
 	b.Put(s0, s1)
 
 	ctx := context.TODO()
-	s, _ := b.Get(ctx)
+	s, _ := b.Get(ctx, "")
 	if s.ID() != "s0" {
 		t.Fatalf("Unexpected source ID: wanted %v, found %v", s0.ID(), s1.ID())
 	}
 
-	s2, err := b.Get(ctx, s1)
+	s2, err := b.Get(ctx, "", s1)
 	if err != nil {
 		t.Fatalf("Unexpected error while getting source: %v", err)
 	}
@@ -144,12 +145,46 @@ func TestGetBlacklist_roundRobin(t *testing.T) {
 
 	// Test with one source blacklisted
 	b.Del(s1)
-	s3, err := b.Get(ctx, s0)
+	s3, err := b.Get(ctx, "", s0)
 	if err == nil {
 		t.Fatalf("Unexpected source %v: wanted an error", s3.ID())
 	}
 }
 
+func TestGet_dryRun(t *testing.T) {
+	tt := []struct {
+		name     string
+		strategy func(b *core.Balancer) core.Strategy
+	}{
+		{"default", func(b *core.Balancer) core.Strategy { return nil }},
+		{"round-robin", func(b *core.Balancer) core.Strategy { return core.RoundRobin() }},
+		{"weighted-round-robin", func(b *core.Balancer) core.Strategy { return core.WeightedRoundRobin(b.Weight) }},
+		{"least-connections", func(b *core.Balancer) core.Strategy { return core.LeastConnections() }},
+	}
+
+	for _, v := range tt {
+		b := &core.Balancer{}
+		b.Strategy = v.strategy(b)
+		b.Put(newMock("s0"), newMock("s1"), newMock("s2"))
+		b.SetWeight("s1", 3)
+
+		dry := core.WithDryRun(context.TODO())
+		for i := 0; i < 5; i++ {
+			peek, err := b.Get(dry, "")
+			if err != nil {
+				t.Fatalf("%s.%d: Unexpected error: %v", v.name, i, err)
+			}
+			if again, _ := b.Get(dry, ""); again.ID() != peek.ID() {
+				t.Fatalf("%s.%d: Dry runs should not change the source returned: %v, then %v", v.name, i, peek.ID(), again.ID())
+			}
+			s, _ := b.Get(context.TODO(), "")
+			if s.ID() != peek.ID() {
+				t.Fatalf("%s.%d: Unexpected source: dry run returned %v, found %v", v.name, i, peek.ID(), s.ID())
+			}
+		}
+	}
+}
+
 func TestDel(t *testing.T) {
 	b := &core.Balancer{}
 
@@ -187,3 +222,130 @@ func TestDel(t *testing.T) {
 		t.Fatal("closeHook was not called")
 	}
 }
+
+// Test that the balancer can be updated while sources are being
+// retrieved. Run with -race.
+func TestGet_concurrent(t *testing.T) {
+	b := &core.Balancer{}
+	s0 := newMock("s0")
+	b.Put(s0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			s1 := newMock("s1")
+			b.Put(s1)
+			b.SetTier(s1.ID(), 1)
+			b.Del(s1)
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		if _, err := b.Get(ctx, "", s0); err != nil {
+			// s1 might be missing.
+			continue
+		}
+		if _, err := b.Get(ctx, ""); err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		b.Do(func(core.Source) {})
+	}
+	cancel()
+	<-done
+}
+
+func benchmarkGet(b *testing.B, strategy core.Strategy, n int) {
+	bl := &core.Balancer{Strategy: strategy}
+	for i := 0; i < n; i++ {
+		bl.Put(&loadMock{mock: newMock(fmt.Sprintf("s%d", i)), conns: i % 7})
+	}
+
+	ctx := context.TODO()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := bl.Get(ctx, "target"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	strategies := []struct {
+		name string
+		s    core.Strategy
+	}{
+		{"roundRobin", core.RoundRobin()},
+		{"leastConnections", core.LeastConnections()},
+		{"powerOfTwoChoices", core.PowerOfTwoChoices},
+	}
+	for _, n := range []int{4, 64, 512} {
+		for _, v := range strategies {
+			b.Run(fmt.Sprintf("%s/%d", v.name, n), func(b *testing.B) {
+				benchmarkGet(b, v.s, n)
+			})
+		}
+	}
+}
+
+// benchmarkStrategy measures the cost of the strategy alone, without
+// the bookkeeping performed by the balancer.
+func benchmarkStrategy(b *testing.B, strategy core.Strategy, n int) {
+	ss := make([]core.Source, n)
+	for i := range ss {
+		ss[i] = &loadMock{mock: newMock(fmt.Sprintf("s%d", i)), conns: i % 7}
+	}
+
+	ctx := context.TODO()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := strategy(ctx, "target", ss); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStrategy(b *testing.B) {
+	strategies := []struct {
+		name string
+		s    core.Strategy
+	}{
+		{"leastConnections", core.LeastConnections()},
+		{"powerOfTwoChoices", core.PowerOfTwoChoices},
+	}
+	for _, n := range []int{4, 64, 512} {
+		for _, v := range strategies {
+			b.Run(fmt.Sprintf("%s/%d", v.name, n), func(b *testing.B) {
+				benchmarkStrategy(b, v.s, n)
+			})
+		}
+	}
+}
+
+// BenchmarkDialLoad simulates the calls performed on the balancer by
+// the dialer and the store for each connection dialed.
+func BenchmarkDialLoad(b *testing.B) {
+	for _, n := range []int{4, 64} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			bl := &core.Balancer{}
+			for i := 0; i < n; i++ {
+				bl.Put(newMock(fmt.Sprintf("s%d", i)))
+			}
+
+			ctx := context.TODO()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = bl.Len()
+					bl.Do(func(core.Source) {})
+					if _, err := bl.Get(ctx, "target"); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
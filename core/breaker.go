@@ -0,0 +1,269 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+// Possible BreakerState values.
+const (
+	// Closed breakers let every request through.
+	Closed BreakerState = iota
+	// Open breakers reject every request.
+	Open
+	// HalfOpen breakers let a trial request through, once per cooldown
+	// period. Its outcome decides whether the breaker is closed or
+	// opened again.
+	HalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Default Breaker configuration.
+const (
+	DefaultBreakerThreshold = 3
+	DefaultBreakerCooldown  = time.Second * 10
+)
+
+// Breaker is a circuit breaker. It opens after Threshold consecutive
+// failures, and after Cooldown it becomes half-open, allowing a trial
+// request to find out if the failure is gone.
+// The zero value of Breaker is ready to use and safe to be used by
+// multiple goroutines.
+type Breaker struct {
+	mux      sync.Mutex
+	state    int32 // BreakerState, read atomically by Allow.
+	failures int
+	since    time.Time // time of the last transition to Open, or of the last trial.
+
+	// Threshold is the number of consecutive failures that
+	// open the breaker. If zero, DefaultBreakerThreshold is used.
+	Threshold int
+	// Cooldown is the time that has to pass before a trial request
+	// is allowed. If zero, DefaultBreakerCooldown is used.
+	Cooldown time.Duration
+	// OnStateChange, if not nil, is called each time the
+	// breaker changes its state.
+	OnStateChange func(from, to BreakerState)
+}
+
+// Allow reports whether a request should be let through.
+func (b *Breaker) Allow() bool {
+	if BreakerState(atomic.LoadInt32(&b.state)) == Closed {
+		// Fast path, without locking.
+		return true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if BreakerState(b.state) == Closed {
+		return true
+	}
+
+	if time.Since(b.since) < b.cooldown() {
+		return false
+	}
+
+	// Allow a trial request.
+	b.since = time.Now()
+	b.set(HalfOpen)
+	return true
+}
+
+// allowed reports whether Allow would let a request through at `now`,
+// without allowing a trial request nor updating the state of the breaker.
+func (b *Breaker) allowed(now time.Time) bool {
+	if BreakerState(atomic.LoadInt32(&b.state)) == Closed {
+		return true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return BreakerState(b.state) == Closed || now.Sub(b.since) >= b.cooldown()
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+// Success records that a request succeeded, closing the breaker.
+func (b *Breaker) Success() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.failures = 0
+	b.set(Closed)
+}
+
+// Failure records that a request failed. The breaker is opened if it
+// is half-open, or if the number of consecutive failures reaches
+// the threshold.
+func (b *Breaker) Failure() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.failures++
+	threshold := b.Threshold
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if BreakerState(b.state) == HalfOpen || b.failures >= threshold {
+		b.since = time.Now()
+		b.set(Open)
+	}
+}
+
+// openedAt returns the time of the last transition of the breaker to Open,
+// or of its last trial.
+func (b *Breaker) openedAt() time.Time {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.since
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	return BreakerState(atomic.LoadInt32(&b.state))
+}
+
+func (b *Breaker) set(s BreakerState) {
+	from := BreakerState(b.state)
+	if from == s {
+		return
+	}
+	atomic.StoreInt32(&b.state, int32(s))
+	if f := b.OnStateChange; f != nil {
+		f(from, s)
+	}
+}
+
+func (b *Balancer) breaker(id string) *Breaker {
+	b.attrs.RLock()
+	br, ok := b.attrs.breakers[id]
+	b.attrs.RUnlock()
+	if ok {
+		return br
+	}
+
+	b.attrs.Lock()
+	defer b.attrs.Unlock()
+
+	if b.attrs.breakers == nil {
+		b.attrs.breakers = make(map[string]*Breaker)
+	}
+	br, ok = b.attrs.breakers[id]
+	if !ok {
+		br = &Breaker{
+			Threshold: b.BreakerThreshold,
+			Cooldown:  b.BreakerCooldown,
+			OnStateChange: func(from, to BreakerState) {
+				// Keep track of the breakers that are not closed, so
+				// that Get can avoid checking them when all of them are.
+				switch {
+				case from == Closed:
+					atomic.AddInt32(&b.tripped, 1)
+				case to == Closed:
+					atomic.AddInt32(&b.tripped, -1)
+				}
+				if f := b.OnBreakerStateChange; f != nil {
+					f(id, to)
+				}
+			},
+		}
+		b.attrs.breakers[id] = br
+	}
+	return br
+}
+
+// ReportDial records the outcome of a dial attempt performed using the
+// source identified by id, updating its circuit breaker. Only the errors
+// that point at the source count as failures, see IsSourceFailure: the
+// others, such as a connection refused by the destination, leave the
+// breaker as it is. Sources which breaker is open are skipped by Get.
+func (b *Balancer) ReportDial(id string, err error) {
+	switch {
+	case err == nil:
+		b.breaker(id).Success()
+	case IsSourceFailure(err):
+		b.breaker(id).Failure()
+	}
+}
+
+// sourceErrnos are the errors that tell that the network could not be
+// reached through the source.
+var sourceErrnos = []syscall.Errno{
+	syscall.ENETUNREACH,
+	syscall.EHOSTUNREACH,
+	syscall.ENETDOWN,
+	syscall.EADDRNOTAVAIL,
+}
+
+// IsSourceFailure reports whether err, returned by a dial attempt, is
+// caused by the source used rather than by the destination: timeouts,
+// unreachable networks or hosts, and local addresses no longer available.
+// Failed DNS lookups and connections refused or reset by the destination
+// are not.
+func IsSourceFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return false
+	}
+	for _, errno := range sourceErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// BreakerState returns the state of the circuit breaker of the source
+// identified by id.
+func (b *Balancer) BreakerState(id string) BreakerState {
+	return b.breaker(id).State()
+}
@@ -0,0 +1,185 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestBreaker(t *testing.T) {
+	var states []core.BreakerState
+	b := &core.Breaker{
+		Threshold: 2,
+		Cooldown:  time.Millisecond * 10,
+		OnStateChange: func(from, to core.BreakerState) {
+			states = append(states, to)
+		},
+	}
+
+	check := func(allow bool, state core.BreakerState) {
+		t.Helper()
+		if ok := b.Allow(); ok != allow {
+			t.Fatalf("Unexpected Allow result: wanted %v, found %v", allow, ok)
+		}
+		if s := b.State(); s != state {
+			t.Fatalf("Unexpected breaker state: wanted %v, found %v", state, s)
+		}
+	}
+
+	check(true, core.Closed)
+	b.Failure()
+	check(true, core.Closed)
+	b.Failure()
+	check(false, core.Open)
+
+	// After the cooldown a trial is allowed, then
+	// the breaker waits for its outcome.
+	time.Sleep(time.Millisecond * 15)
+	check(true, core.HalfOpen)
+	check(false, core.HalfOpen)
+
+	// A failing trial opens the breaker again.
+	b.Failure()
+	check(false, core.Open)
+
+	time.Sleep(time.Millisecond * 15)
+	check(true, core.HalfOpen)
+	b.Success()
+	check(true, core.Closed)
+
+	want := []core.BreakerState{core.Open, core.HalfOpen, core.Open, core.HalfOpen, core.Closed}
+	if len(states) != len(want) {
+		t.Fatalf("Unexpected state changes: wanted %v, found %v", want, states)
+	}
+	for i, v := range want {
+		if states[i] != v {
+			t.Fatalf("%d: Unexpected state change: wanted %v, found %v", i, v, states[i])
+		}
+	}
+}
+
+func TestGet_breaker(t *testing.T) {
+	b := &core.Balancer{BreakerThreshold: 1}
+
+	s0 := newMock("s0")
+	s1 := newMock("s1")
+	backup := newMock("backup")
+	b.Put(s0, s1, backup)
+	b.SetTier(backup.ID(), 1)
+
+	ctx := context.TODO()
+	b.ReportDial(s0.ID(), context.DeadlineExceeded)
+	if s := b.BreakerState(s0.ID()); s != core.Open {
+		t.Fatalf("Unexpected breaker state: wanted %v, found %v", core.Open, s)
+	}
+	for i := 0; i < 3; i++ {
+		s, err := b.Get(ctx, "")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		if s.ID() != s1.ID() {
+			t.Fatalf("%d: Unexpected source ID: wanted %v, found %v", i, s1.ID(), s.ID())
+		}
+	}
+
+	// When the whole primary tier is failing, the backup is used.
+	b.ReportDial(s1.ID(), context.DeadlineExceeded)
+	s, err := b.Get(ctx, "")
+	if err != nil {
+		t.Fatalf("Unexpected error while getting source: %v", err)
+	}
+	if s.ID() != backup.ID() {
+		t.Fatalf("Unexpected source ID: wanted %v, found %v", backup.ID(), s.ID())
+	}
+
+	// Adding the source again closes its breaker.
+	b.Del(s0)
+	b.Put(s0)
+	if s := b.BreakerState(s0.ID()); s != core.Closed {
+		t.Fatalf("Unexpected breaker state: wanted %v, found %v", core.Closed, s)
+	}
+}
+
+func TestIsSourceFailure(t *testing.T) {
+	tt := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: context.DeadlineExceeded, want: true},
+		{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, want: true},
+		{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, want: true},
+		{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("bind", syscall.EADDRNOTAVAIL)}, want: true},
+		{err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, want: false},
+		{err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}, want: false},
+		{err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}}, want: false},
+		{err: errors.New("dial timeout"), want: false},
+	}
+
+	for i, v := range tt {
+		if ok := core.IsSourceFailure(v.err); ok != v.want {
+			t.Fatalf("%d: Unexpected result for %v: wanted %v, found %v", i, v.err, v.want, ok)
+		}
+	}
+}
+
+func TestReportDial_destinationFailure(t *testing.T) {
+	b := &core.Balancer{BreakerThreshold: 1}
+	s0 := newMock("s0")
+	b.Put(s0)
+
+	b.ReportDial(s0.ID(), &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})
+	b.ReportDial(s0.ID(), &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}})
+	if s := b.BreakerState(s0.ID()); s != core.Closed {
+		t.Fatalf("Unexpected breaker state: wanted %v, found %v", core.Closed, s)
+	}
+}
+
+func TestGet_breakerFallback(t *testing.T) {
+	b := &core.Balancer{BreakerThreshold: 1, BreakerCooldown: time.Hour}
+
+	s0 := newMock("s0")
+	s1 := newMock("s1")
+	b.Put(s0, s1)
+
+	ctx := context.TODO()
+	b.ReportDial(s0.ID(), context.DeadlineExceeded)
+	time.Sleep(time.Millisecond * 2)
+	b.ReportDial(s1.ID(), context.DeadlineExceeded)
+
+	// When every breaker is open, the source which breaker
+	// opened least recently is returned.
+	s, err := b.Get(ctx, "")
+	if err != nil {
+		t.Fatalf("Unexpected error while getting source: %v", err)
+	}
+	if s.ID() != s0.ID() {
+		t.Fatalf("Unexpected source ID: wanted %v, found %v", s0.ID(), s.ID())
+	}
+
+	// Blacklisted sources are never used as fallback.
+	if _, err := b.Get(ctx, "", s0, s1); err == nil {
+		t.Fatalf("Expected an error when every source is blacklisted")
+	}
+}
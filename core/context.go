@@ -0,0 +1,69 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import "context"
+
+type contextKey int
+
+const (
+	networkKey contextKey = iota
+	dryRunKey
+	clientKey
+)
+
+// WithNetwork returns a copy of ctx that carries the network, such as
+// "tcp" or "udp", of the connection that is being dialed. Balancers and
+// policies may use it to select the source of the connection.
+func WithNetwork(ctx context.Context, network string) context.Context {
+	return context.WithValue(ctx, networkKey, network)
+}
+
+// NetworkFromContext returns the network stored in ctx by WithNetwork,
+// if any.
+func NetworkFromContext(ctx context.Context) (string, bool) {
+	network, ok := ctx.Value(networkKey).(string)
+	return network, ok
+}
+
+// WithDryRun returns a copy of ctx which tells the balancer and its
+// strategy that the source returned will not be used, i.e. that they
+// should not update their state, so that the same source is returned by
+// the next call. Strategies that pick sources at random cannot honour it.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey, true)
+}
+
+// IsDryRun reports whether ctx was created with WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	dry, _ := ctx.Value(dryRunKey).(bool)
+	return dry
+}
+
+// WithClient returns a copy of ctx that carries the address, with or
+// without port, of the client that requested the connection being
+// dialed, such as the client of a proxy. Policies may use it to select
+// the source of the connection.
+func WithClient(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientKey, addr)
+}
+
+// ClientFromContext returns the client address stored in ctx by
+// WithClient, if any.
+func ClientFromContext(ctx context.Context) (string, bool) {
+	addr, ok := ctx.Value(clientKey).(string)
+	return addr, ok
+}
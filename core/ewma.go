@@ -0,0 +1,66 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync"
+)
+
+// DefaultSmoothing is the smoothing factor used by an EWMA
+// which Alpha field is not set.
+const DefaultSmoothing = 0.2
+
+// EWMA is an exponentially weighted moving average. The zero
+// value of EWMA is ready to use and safe to be used by multiple
+// goroutines.
+type EWMA struct {
+	mux sync.Mutex
+	val float64
+	set bool
+
+	// Alpha is the smoothing factor, in the range (0, 1]. Higher
+	// values discount older observations faster. If Alpha is
+	// zero, DefaultSmoothing is used.
+	Alpha float64
+}
+
+// Add adds v to the moving average. The first value added
+// is used as initial value of the average.
+func (e *EWMA) Add(v float64) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if !e.set {
+		e.val = v
+		e.set = true
+		return
+	}
+
+	a := e.Alpha
+	if a <= 0 || a > 1 {
+		a = DefaultSmoothing
+	}
+	e.val = a*v + (1-a)*e.val
+}
+
+// Value returns the current value of the moving average, which
+// is 0 if no value was added yet.
+func (e *EWMA) Value() float64 {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return e.val
+}
@@ -0,0 +1,99 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultReplicas is the number of virtual nodes per source used by
+// ConsistentHash when the number provided is not positive.
+const DefaultReplicas = 100
+
+type hashPoint struct {
+	hash uint32
+	id   string
+}
+
+// ConsistentHash returns a Strategy that deterministically maps each
+// target to a source, using a hash ring with `replicas` virtual nodes
+// per source. When a source is added or removed, only the targets that
+// were assigned to it, or that are assigned to it from now on, are
+// remapped.
+// Sources that are not part of the ring anymore, or that are blacklisted,
+// are skipped by walking the hash ring clockwise until a suitable source
+// is found.
+func ConsistentHash(replicas int) Strategy {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	var mux sync.Mutex
+	var points []hashPoint
+	known := make(map[string]bool)
+
+	return func(ctx context.Context, target string, ss []Source) (Source, error) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		candidates := make(map[string]Source, len(ss))
+		var added bool
+		for _, s := range ss {
+			id := s.ID()
+			candidates[id] = s
+			if known[id] {
+				continue
+			}
+			// First time that we see this source: add its
+			// virtual nodes to the hash ring.
+			for i := 0; i < replicas; i++ {
+				points = append(points, hashPoint{
+					hash: crc32.ChecksumIEEE([]byte(id + "#" + strconv.Itoa(i))),
+					id:   id,
+				})
+			}
+			known[id] = true
+			added = true
+		}
+		if len(candidates) == 0 {
+			return nil, errors.New("consistent hash: no source available")
+		}
+		if added {
+			sort.Slice(points, func(i, j int) bool {
+				return points[i].hash < points[j].hash
+			})
+		}
+
+		h := crc32.ChecksumIEEE([]byte(target))
+		i := sort.Search(len(points), func(i int) bool {
+			return points[i].hash >= h
+		})
+		for j := 0; j < len(points); j++ {
+			p := points[(i+j)%len(points)]
+			if s, ok := candidates[p.id]; ok {
+				return s, nil
+			}
+		}
+
+		// Not reachable, as each candidate is in the hash ring.
+		return nil, errors.New("consistent hash: no source available")
+	}
+}
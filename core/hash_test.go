@@ -0,0 +1,93 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestGet_consistentHash(t *testing.T) {
+	b := &core.Balancer{Strategy: core.ConsistentHash(0)}
+
+	s0 := newMock("s0")
+	s1 := newMock("s1")
+	s2 := newMock("s2")
+	b.Put(s0, s1, s2)
+
+	targets := make([]string, 100)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("host%d.com", i)
+	}
+
+	ctx := context.TODO()
+	assign := func() map[string]string {
+		m := make(map[string]string)
+		for _, v := range targets {
+			s, err := b.Get(ctx, v)
+			if err != nil {
+				t.Fatalf("Unexpected error while getting source for %s: %v", v, err)
+			}
+			m[v] = s.ID()
+		}
+		return m
+	}
+
+	// The same target is always mapped to the same source.
+	m0 := assign()
+	m1 := assign()
+	for _, v := range targets {
+		if m0[v] != m1[v] {
+			t.Fatalf("Unexpected source for %s: wanted %s, found %s", v, m0[v], m1[v])
+		}
+	}
+
+	// Removing a source remaps only the targets that
+	// were assigned to it.
+	b.Del(s1)
+	m2 := assign()
+	for _, v := range targets {
+		if m0[v] != s1.ID() && m0[v] != m2[v] {
+			t.Fatalf("Unexpected remap of %s: from %s to %s", v, m0[v], m2[v])
+		}
+		if m2[v] == s1.ID() {
+			t.Fatalf("Unexpected removed source %s assigned to %s", s1.ID(), v)
+		}
+	}
+
+	// Adding it back restores the original assignment.
+	b.Put(s1)
+	m3 := assign()
+	for _, v := range targets {
+		if m0[v] != m3[v] {
+			t.Fatalf("Unexpected source for %s: wanted %s, found %s", v, m0[v], m3[v])
+		}
+	}
+
+	// Blacklisted sources are skipped.
+	for _, v := range targets {
+		s, err := b.Get(ctx, v, s0)
+		if err != nil {
+			t.Fatalf("Unexpected error while getting source for %s: %v", v, err)
+		}
+		if s.ID() == s0.ID() {
+			t.Fatalf("Unexpected blacklisted source assigned to %s", v)
+		}
+	}
+}
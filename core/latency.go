@@ -0,0 +1,66 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyReporter is an optional interface that Sources may implement
+// in order to report how fast they are at delivering the first byte
+// of a new connection.
+type LatencyReporter interface {
+	// Latency returns the average latency measured by the source,
+	// or 0 if no measurement is available yet.
+	Latency() time.Duration
+}
+
+// LowestLatency returns a Strategy that prefers the source with the
+// lowest average latency. Sources that do not implement LatencyReporter,
+// or that did not collect any measurement yet, report a latency of 0 and
+// are hence preferred: this makes sure that new sources are tried, and
+// measured, as soon as possible. Ties are broken using round robin, so
+// that sources with the same latency, such as the ones not measured yet,
+// share the traffic.
+// Every n-th call the strategy falls back to RoundRobin, so that the
+// other sources keep on receiving some traffic and their latency
+// measurements stay fresh. If n <= 1, RoundRobin is never used.
+func LowestLatency(n int) Strategy {
+	var count, cursor uint64
+	rr := RoundRobin()
+	return func(ctx context.Context, target string, ss []Source) (Source, error) {
+		c := atomic.LoadUint64(&count) + 1
+		if !IsDryRun(ctx) {
+			c = atomic.AddUint64(&count, 1)
+		}
+		if n > 1 && c%uint64(n) == 0 {
+			return rr(ctx, target, ss)
+		}
+
+		if len(ss) == 0 {
+			return nil, errors.New("lowest latency: no source available")
+		}
+		return lowest(ctx, ss, &cursor, func(s Source) float64 {
+			if lr, ok := s.(LatencyReporter); ok {
+				return float64(lr.Latency())
+			}
+			return 0
+		}), nil
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+type latencyMock struct {
+	*mock
+	latency time.Duration
+}
+
+func (s *latencyMock) Latency() time.Duration {
+	return s.latency
+}
+
+func TestEWMA(t *testing.T) {
+	e := &core.EWMA{Alpha: 0.5}
+	if v := e.Value(); v != 0 {
+		t.Fatalf("Unexpected initial value: wanted 0, found %v", v)
+	}
+
+	tt := []struct {
+		in  float64
+		out float64
+	}{
+		{in: 10, out: 10},
+		{in: 20, out: 15},
+		{in: 5, out: 10},
+	}
+	for i, v := range tt {
+		e.Add(v.in)
+		if e.Value() != v.out {
+			t.Fatalf("%d: Unexpected value: wanted %v, found %v", i, v.out, e.Value())
+		}
+	}
+}
+
+func TestGet_lowestLatency(t *testing.T) {
+	s0 := &latencyMock{mock: newMock("s0"), latency: time.Millisecond * 600}
+	s1 := &latencyMock{mock: newMock("s1"), latency: time.Millisecond * 10}
+	s2 := &latencyMock{mock: newMock("s2"), latency: time.Millisecond * 80}
+
+	b := &core.Balancer{Strategy: core.LowestLatency(4)}
+	b.Put(s0, s1, s2)
+
+	ctx := context.TODO()
+	count := make(map[string]int)
+	for i := 0; i < 12; i++ {
+		s, err := b.Get(ctx, "")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		count[s.ID()]++
+	}
+
+	// 3 requests out of 12 are served using round robin.
+	if count["s1"] != 10 {
+		t.Fatalf("Unexpected number of requests served by the fastest source: wanted 10, found %d (%v)", count["s1"], count)
+	}
+	if count["s0"] != 1 || count["s2"] != 1 {
+		t.Fatalf("Unexpected number of requests served by the slower sources: wanted 1 each, found %v", count)
+	}
+
+	// Blacklisting the fastest source makes the balancer
+	// pick the second fastest one.
+	for i := 0; i < 3; i++ {
+		s, err := b.Get(ctx, "", s1)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		if s.ID() == "s1" {
+			t.Fatalf("%d: Unexpected blacklisted source %v", i, s.ID())
+		}
+	}
+}
+
+func TestGet_lowestLatencyUnmeasured(t *testing.T) {
+	s0 := &latencyMock{mock: newMock("s0"), latency: time.Millisecond * 10}
+	s1 := &latencyMock{mock: newMock("s1")}
+
+	b := &core.Balancer{Strategy: core.LowestLatency(0)}
+	b.Put(s0, s1)
+
+	// Sources without measurements are tried first.
+	s, err := b.Get(context.TODO(), "")
+	if err != nil {
+		t.Fatalf("Unexpected error while getting source: %v", err)
+	}
+	if s.ID() != "s1" {
+		t.Fatalf("Unexpected source ID: wanted s1, found %v", s.ID())
+	}
+}
+
+func TestGet_lowestLatencyTies(t *testing.T) {
+	s0 := &latencyMock{mock: newMock("s0")}
+	s1 := &latencyMock{mock: newMock("s1")}
+	s2 := newMock("s2")
+
+	b := &core.Balancer{Strategy: core.LowestLatency(0)}
+	b.Put(s0, s1, s2)
+
+	// No source is measured yet: each one receives
+	// some traffic.
+	count := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		s, err := b.Get(context.TODO(), "")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		count[s.ID()]++
+	}
+	for _, id := range []string{"s0", "s1", "s2"} {
+		if count[id] != 2 {
+			t.Fatalf("Unexpected number of requests served by %s: wanted 2, found %v", id, count)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// LoadReporter is an optional interface that Sources may implement
+// in order to report how many connections they are currently handling.
+type LoadReporter interface {
+	// Len returns the number of open connections.
+	Len() int
+}
+
+// Load returns the number of connections that s is currently handling,
+// or 0 if s does not implement LoadReporter.
+func Load(s Source) int {
+	if lr, ok := s.(LoadReporter); ok {
+		return lr.Len()
+	}
+	return 0
+}
+
+// LeastConnections returns a strategy that selects the source with the
+// lowest number of open connections, see LoadReporter. Ties are broken
+// using round robin.
+func LeastConnections() Strategy {
+	var cursor uint64
+	return func(ctx context.Context, target string, ss []Source) (Source, error) {
+		if len(ss) == 0 {
+			return nil, errors.New("least connections: no source available")
+		}
+		return lowest(ctx, ss, &cursor, func(s Source) float64 {
+			return float64(Load(s))
+		}), nil
+	}
+}
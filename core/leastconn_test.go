@@ -0,0 +1,63 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+type loadMock struct {
+	*mock
+	conns int
+}
+
+func (s *loadMock) Len() int {
+	return s.conns
+}
+
+func TestGet_leastConnections(t *testing.T) {
+	s0 := &loadMock{mock: newMock("s0"), conns: 4}
+	s1 := &loadMock{mock: newMock("s1"), conns: 1}
+	s2 := &loadMock{mock: newMock("s2"), conns: 1}
+
+	b := &core.Balancer{Strategy: core.LeastConnections()}
+	b.Put(s0, s1, s2)
+
+	// s1 and s2 have the same load: the tie is broken
+	// using round robin.
+	tt := []string{"s1", "s2", "s1", "s2"}
+	for i, v := range tt {
+		s, err := b.Get(context.TODO(), "")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		if s.ID() != v {
+			t.Fatalf("%d: Unexpected source ID: wanted %v, found %v", i, v, s.ID())
+		}
+	}
+
+	s2.conns = 5
+	s, err := b.Get(context.TODO(), "", s1)
+	if err != nil {
+		t.Fatalf("Unexpected error while getting source: %v", err)
+	}
+	if s.ID() != "s0" {
+		t.Fatalf("Unexpected source ID: wanted s0, found %v", s.ID())
+	}
+}
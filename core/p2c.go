@@ -0,0 +1,67 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+)
+
+// PowerOfTwoChoices is a strategy that samples two distinct sources
+// at random, and returns the less loaded one, i.e. the one with fewer
+// open connections (see LoadReporter). If the load is the same, the
+// source with the lowest latency is preferred (see LatencyReporter).
+// Unlike LeastConnections, it does not have to inspect every source,
+// which makes it suitable for large sets of sources.
+func PowerOfTwoChoices(ctx context.Context, target string, ss []Source) (Source, error) {
+	n := len(ss)
+	if n == 0 {
+		return nil, errors.New("power of two choices: no source available")
+	}
+	if n == 1 {
+		return ss[0], nil
+	}
+
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := ss[i], ss[j]
+	if lessLoaded(b, a) {
+		return b, nil
+	}
+	return a, nil
+}
+
+// lessLoaded reports whether a is less loaded than b.
+func lessLoaded(a, b Source) bool {
+	la, lb := Load(a), Load(b)
+	if la != lb {
+		return la < lb
+	}
+
+	var da, db int64
+	if lr, ok := a.(LatencyReporter); ok {
+		da = int64(lr.Latency())
+	}
+	if lr, ok := b.(LatencyReporter); ok {
+		db = int64(lr.Latency())
+	}
+	return da < db
+}
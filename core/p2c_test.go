@@ -0,0 +1,46 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestGet_powerOfTwoChoices(t *testing.T) {
+	b := &core.Balancer{Strategy: core.PowerOfTwoChoices}
+
+	busy := &loadMock{mock: newMock("busy"), conns: 10}
+	b.Put(busy)
+	for i := 0; i < 4; i++ {
+		b.Put(&loadMock{mock: newMock(fmt.Sprintf("s%d", i)), conns: i})
+	}
+
+	// The most loaded source is never the less loaded
+	// of the two sampled.
+	for i := 0; i < 100; i++ {
+		s, err := b.Get(context.TODO(), "")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		if s.ID() == busy.ID() {
+			t.Fatalf("%d: Unexpected most loaded source %v", i, s.ID())
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// StrategyFactory creates a new Strategy instance that will be used
+// by b. The balancer is provided as some strategies depend on the
+// attributes that it stores, such as weights.
+type StrategyFactory func(b *Balancer) Strategy
+
+// DefaultStrategy is the name of the strategy used by a Balancer
+// that was not configured otherwise.
+const DefaultStrategy = "round-robin"
+
+var registry = struct {
+	sync.RWMutex
+	val map[string]StrategyFactory
+}{val: make(map[string]StrategyFactory)}
+
+func init() {
+	RegisterStrategy(DefaultStrategy, func(b *Balancer) Strategy {
+		return RoundRobin()
+	})
+	RegisterStrategy("weighted-round-robin", func(b *Balancer) Strategy {
+		return WeightedRoundRobin(b.Weight)
+	})
+	RegisterStrategy("least-connections", func(b *Balancer) Strategy {
+		return LeastConnections()
+	})
+	RegisterStrategy("throughput", func(b *Balancer) Strategy {
+		return MostHeadroom(b.Headroom)
+	})
+	RegisterStrategy("consistent-hash", func(b *Balancer) Strategy {
+		return ConsistentHash(DefaultReplicas)
+	})
+	RegisterStrategy("power-of-two", func(b *Balancer) Strategy {
+		return PowerOfTwoChoices
+	})
+	RegisterStrategy("latency", func(b *Balancer) Strategy {
+		// Use round robin once every 10 requests to keep
+		// the latency of the other sources updated.
+		return LowestLatency(10)
+	})
+}
+
+// RegisterStrategy makes a strategy available by the provided name.
+// If RegisterStrategy is called twice with the same name or if f is nil,
+// it panics.
+func RegisterStrategy(name string, f StrategyFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if f == nil {
+		panic("core: RegisterStrategy factory is nil")
+	}
+	if _, ok := registry.val[name]; ok {
+		panic("core: RegisterStrategy called twice for strategy " + name)
+	}
+	registry.val[name] = f
+}
+
+// Strategies returns a sorted list of the names of the registered
+// strategies.
+func Strategies() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	acc := make([]string, 0, len(registry.val))
+	for k := range registry.val {
+		acc = append(acc, k)
+	}
+	sort.Strings(acc)
+	return acc
+}
+
+// NewStrategy creates a new instance of the strategy registered
+// as name, that will be used by b.
+func NewStrategy(name string, b *Balancer) (Strategy, error) {
+	registry.RLock()
+	f, ok := registry.val[name]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("core: unknown strategy %q", name)
+	}
+	return f(b), nil
+}
+
+// namedStrategy is the value stored by Balancer.UseStrategy.
+type namedStrategy struct {
+	name string
+	Strategy
+}
+
+// UseStrategy makes the balancer use the strategy registered as name.
+// It is safe to call UseStrategy while the balancer is being used: the
+// new strategy affects only the sources retrieved afterwards.
+func (b *Balancer) UseStrategy(name string) error {
+	s, err := NewStrategy(name, b)
+	if err != nil {
+		return err
+	}
+
+	b.named.Store(&namedStrategy{name: name, Strategy: s})
+	return nil
+}
+
+// StrategyName returns the name of the strategy in use, or an empty
+// string if the strategy was set through the Strategy field.
+func (b *Balancer) StrategyName() string {
+	if ns, ok := b.named.Load().(*namedStrategy); ok {
+		return ns.name
+	}
+	if b.Strategy == nil {
+		return DefaultStrategy
+	}
+	return ""
+}
+
+func (b *Balancer) strategy() Strategy {
+	if ns, ok := b.named.Load().(*namedStrategy); ok {
+		return ns.Strategy
+	}
+	if b.Strategy != nil {
+		return b.Strategy
+	}
+	return b.roundRobin
+}
@@ -0,0 +1,80 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestStrategies(t *testing.T) {
+	names := core.Strategies()
+	found := false
+	for _, v := range names {
+		if v == core.DefaultStrategy {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Default strategy %s not registered: %v", core.DefaultStrategy, names)
+	}
+
+	b := &core.Balancer{}
+	for _, v := range names {
+		if _, err := core.NewStrategy(v, b); err != nil {
+			t.Fatalf("Unexpected error creating strategy %s: %v", v, err)
+		}
+	}
+	if _, err := core.NewStrategy("foo", b); err == nil {
+		t.Fatal("Unexpected nil error creating unknown strategy")
+	}
+}
+
+func TestUseStrategy(t *testing.T) {
+	b := &core.Balancer{}
+	if name := b.StrategyName(); name != core.DefaultStrategy {
+		t.Fatalf("Unexpected strategy name: wanted %s, found %s", core.DefaultStrategy, name)
+	}
+
+	s0 := &loadMock{mock: newMock("s0"), conns: 0}
+	s1 := &loadMock{mock: newMock("s1"), conns: 5}
+	b.Put(s0, s1)
+
+	ctx := context.TODO()
+	if s, _ := b.Get(ctx, ""); s.ID() != "s0" {
+		t.Fatalf("Unexpected source ID: wanted s0, found %v", s.ID())
+	}
+	if s, _ := b.Get(ctx, ""); s.ID() != "s1" {
+		t.Fatalf("Unexpected source ID: wanted s1, found %v", s.ID())
+	}
+
+	if err := b.UseStrategy("foo"); err == nil {
+		t.Fatal("Unexpected nil error using unknown strategy")
+	}
+	if err := b.UseStrategy("least-connections"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name := b.StrategyName(); name != "least-connections" {
+		t.Fatalf("Unexpected strategy name: wanted least-connections, found %s", name)
+	}
+	for i := 0; i < 3; i++ {
+		if s, _ := b.Get(ctx, ""); s.ID() != "s0" {
+			t.Fatalf("%d: Unexpected source ID: wanted s0, found %v", i, s.ID())
+		}
+	}
+}
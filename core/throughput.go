@@ -0,0 +1,192 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Direction tells whether data is being received or sent.
+type Direction int
+
+// Possible Direction values.
+const (
+	Download Direction = iota
+	Upload
+)
+
+// DefaultRateWindow is the window used by a RateMeter which Window
+// field is not set.
+const DefaultRateWindow = time.Second
+
+// RateMeter estimates the rate, in bytes/second, of a data transmission.
+// The bytes transmitted are accumulated over a window, and at the end of
+// each window the rate measured is added to a moving average.
+// The zero value of RateMeter is ready to use and safe to be used by
+// multiple goroutines.
+type RateMeter struct {
+	mux   sync.Mutex
+	avg   EWMA
+	peak  float64
+	n     int
+	start time.Time
+
+	// Window is the amount of time over which the bytes are accumulated
+	// before computing a rate sample. If Window is zero, DefaultRateWindow
+	// is used.
+	Window time.Duration
+}
+
+// Add records that n bytes were transmitted.
+func (m *RateMeter) Add(n int) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.update(time.Now())
+	m.n += n
+}
+
+// Rate returns the moving average of the transmission rate, in
+// bytes/second.
+func (m *RateMeter) Rate() float64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.update(time.Now())
+	return m.avg.Value()
+}
+
+// Peak returns the highest rate ever reported by the meter, which
+// is used as an estimate of the capacity of the channel.
+func (m *RateMeter) Peak() float64 {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.update(time.Now())
+	return m.peak
+}
+
+func (m *RateMeter) update(now time.Time) {
+	if m.start.IsZero() {
+		m.start = now
+		return
+	}
+
+	w := m.Window
+	if w <= 0 {
+		w = DefaultRateWindow
+	}
+	d := now.Sub(m.start)
+	if d < w {
+		return
+	}
+
+	m.avg.Add(float64(m.n) / d.Seconds())
+	m.n = 0
+	m.start = now
+	if v := m.avg.Value(); v > m.peak {
+		m.peak = v
+	}
+}
+
+// throughput collects the data transmission rate of a source, in both
+// directions.
+type throughput struct {
+	download RateMeter
+	upload   RateMeter
+}
+
+func (t *throughput) meter(d Direction) *RateMeter {
+	if d == Upload {
+		return &t.upload
+	}
+	return &t.download
+}
+
+func (b *Balancer) throughput(id string) *throughput {
+	b.attrs.RLock()
+	t, ok := b.attrs.throughput[id]
+	b.attrs.RUnlock()
+	if ok {
+		return t
+	}
+
+	b.attrs.Lock()
+	defer b.attrs.Unlock()
+
+	if b.attrs.throughput == nil {
+		b.attrs.throughput = make(map[string]*throughput)
+	}
+	t, ok = b.attrs.throughput[id]
+	if !ok {
+		t = new(throughput)
+		b.attrs.throughput[id] = t
+	}
+	return t
+}
+
+// AddTransfer records that n bytes were transmitted by the source
+// identified by id, in direction d.
+func (b *Balancer) AddTransfer(id string, d Direction, n int) {
+	b.throughput(id).meter(d).Add(n)
+}
+
+// Throughput returns the moving average of the transmission rate, in
+// bytes/second, of the source identified by id, in direction d.
+func (b *Balancer) Throughput(id string, d Direction) float64 {
+	return b.throughput(id).meter(d).Rate()
+}
+
+// Headroom returns the spare bandwidth of the source identified by id,
+// in bytes/second, computed as the difference between the peak rate
+// ever measured and the current rate, summing both directions.
+// Sources without measurements report an infinite headroom.
+func (b *Balancer) Headroom(id string) float64 {
+	t := b.throughput(id)
+	var h float64
+	var measured bool
+	for _, m := range []*RateMeter{&t.download, &t.upload} {
+		peak := m.Peak()
+		if peak == 0 {
+			continue
+		}
+		measured = true
+		h += math.Max(peak-m.Rate(), 0)
+	}
+	if !measured {
+		return math.Inf(1)
+	}
+	return h
+}
+
+// MostHeadroom returns a Strategy that selects the source with the
+// highest spare bandwidth, according to headroom (see Balancer.Headroom).
+// Ties are broken using round robin.
+func MostHeadroom(headroom func(id string) float64) Strategy {
+	var cursor uint64
+	return func(ctx context.Context, target string, ss []Source) (Source, error) {
+		if len(ss) == 0 {
+			return nil, errors.New("most headroom: no source available")
+		}
+		return lowest(ctx, ss, &cursor, func(s Source) float64 {
+			return -headroom(s.ID())
+		}), nil
+	}
+}
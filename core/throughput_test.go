@@ -0,0 +1,96 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestRateMeter(t *testing.T) {
+	m := &core.RateMeter{Window: 20 * time.Millisecond}
+	if r := m.Rate(); r != 0 {
+		t.Fatalf("Unexpected initial rate: wanted 0, found %v", r)
+	}
+
+	m.Add(1000)
+	time.Sleep(25 * time.Millisecond)
+	r := m.Rate()
+	if r <= 0 {
+		t.Fatalf("Unexpected rate: wanted > 0, found %v", r)
+	}
+	if p := m.Peak(); p != r {
+		t.Fatalf("Unexpected peak: wanted %v, found %v", r, p)
+	}
+
+	// Without any transmission, the rate decreases while the
+	// peak stays the same.
+	time.Sleep(25 * time.Millisecond)
+	if r1 := m.Rate(); r1 >= r {
+		t.Fatalf("Unexpected rate: wanted < %v, found %v", r, r1)
+	}
+	if p := m.Peak(); p != r {
+		t.Fatalf("Unexpected peak: wanted %v, found %v", r, p)
+	}
+}
+
+func TestHeadroom(t *testing.T) {
+	b := &core.Balancer{}
+	if h := b.Headroom("s0"); !math.IsInf(h, 1) {
+		t.Fatalf("Unexpected headroom of unmeasured source: wanted +Inf, found %v", h)
+	}
+	if r := b.Throughput("s0", core.Download); r != 0 {
+		t.Fatalf("Unexpected throughput of unmeasured source: wanted 0, found %v", r)
+	}
+}
+
+func TestGet_mostHeadroom(t *testing.T) {
+	headroom := map[string]float64{
+		"s0": 100,
+		"s1": 5000,
+		"s2": 5000,
+	}
+	b := &core.Balancer{Strategy: core.MostHeadroom(func(id string) float64 {
+		return headroom[id]
+	})}
+	b.Put(newMock("s0"), newMock("s1"), newMock("s2"))
+
+	// s1 and s2 have the same headroom: the tie is broken
+	// using round robin.
+	tt := []string{"s1", "s2", "s1", "s2"}
+	for i, v := range tt {
+		s, err := b.Get(context.TODO(), "")
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		if s.ID() != v {
+			t.Fatalf("%d: Unexpected source ID: wanted %v, found %v", i, v, s.ID())
+		}
+	}
+
+	headroom["s0"] = math.Inf(1)
+	s, err := b.Get(context.TODO(), "")
+	if err != nil {
+		t.Fatalf("Unexpected error while getting source: %v", err)
+	}
+	if s.ID() != "s0" {
+		t.Fatalf("Unexpected source ID: wanted s0, found %v", s.ID())
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SetTier assigns the source identified by id to priority tier t. Tier 0
+// has the highest priority, and is the one to which sources belong
+// by default.
+// The balancer only uses the sources of tier N+1 when every source of
+// tier N is either missing or blacklisted, i.e. blocked by a policy or
+// failing. As soon as one of the sources of tier N is available again,
+// it is preferred over the others.
+func (b *Balancer) SetTier(id string, t int) error {
+	if t < 0 {
+		return fmt.Errorf("balancer: invalid tier %d for source %s: must not be negative", t, id)
+	}
+
+	b.attrs.Lock()
+	if b.attrs.tiers == nil {
+		b.attrs.tiers = make(map[string]int)
+	}
+	b.attrs.tiers[id] = t
+	b.attrs.Unlock()
+
+	// Update the snapshot, which contains the tier of each source.
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.update(b.load().sources)
+	return nil
+}
+
+// Tier returns the priority tier of the source identified by id.
+func (b *Balancer) Tier(id string) int {
+	b.attrs.RLock()
+	defer b.attrs.RUnlock()
+
+	return b.attrs.tiers[id]
+}
+
+// ActiveTier returns the priority tier of the last source returned
+// by Get. ok is false if Get did not return any source yet.
+func (b *Balancer) ActiveTier() (t int, ok bool) {
+	v := atomic.LoadInt64(&b.tier)
+	return int(v - 1), v != 0
+}
+
+func (b *Balancer) setActiveTier(t int) {
+	// Avoid writing if the value did not change, as Get
+	// is called concurrently on the hot path.
+	if v := int64(t) + 1; atomic.LoadInt64(&b.tier) != v {
+		atomic.StoreInt64(&b.tier, v)
+	}
+}
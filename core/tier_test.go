@@ -0,0 +1,75 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestGet_tiers(t *testing.T) {
+	b := &core.Balancer{}
+	if _, ok := b.ActiveTier(); ok {
+		t.Fatal("Unexpected active tier before any Get")
+	}
+	if err := b.SetTier("s0", -1); err == nil {
+		t.Fatal("Unexpected nil error setting negative tier")
+	}
+
+	fiber0 := newMock("fiber0")
+	fiber1 := newMock("fiber1")
+	lte := newMock("lte")
+	b.Put(lte, fiber0, fiber1)
+	b.SetTier(lte.ID(), 1)
+
+	ctx := context.TODO()
+	get := func(want string, tier int, blacklist ...core.Source) {
+		t.Helper()
+		s, err := b.Get(ctx, "", blacklist...)
+		if err != nil {
+			t.Fatalf("Unexpected error while getting source: %v", err)
+		}
+		if want != "" && s.ID() != want {
+			t.Fatalf("Unexpected source ID: wanted %v, found %v", want, s.ID())
+		}
+		if s.ID() == lte.ID() && tier == 0 {
+			t.Fatalf("Unexpected backup source %v", s.ID())
+		}
+		if at, _ := b.ActiveTier(); at != tier {
+			t.Fatalf("Unexpected active tier: wanted %d, found %d", tier, at)
+		}
+	}
+
+	// Only the primary tier is used.
+	for i := 0; i < 4; i++ {
+		get("", 0)
+	}
+
+	// The backup is used only when every primary source
+	// is unavailable.
+	get("fiber1", 0, fiber0)
+	get("lte", 1, fiber0, fiber1)
+
+	b.Del(fiber0, fiber1)
+	get("lte", 1)
+
+	// Once the primary recovers, it is used again.
+	b.Put(fiber0)
+	get("fiber0", 0)
+	get("fiber0", 0)
+}
@@ -0,0 +1,65 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// WeightedRoundRobin returns a Strategy that implements a smooth weighted
+// round robin: each source receives a share of the calls proportional
+// to its weight, but the picks are interleaved, i.e. a source with
+// weight 5 in a set of sources with weights {5, 1, 1} is not selected
+// 5 times in a row.
+// weight is used to retrieve the weight of each source, see Balancer.Weight.
+func WeightedRoundRobin(weight func(id string) int) Strategy {
+	var mux sync.Mutex
+	current := make(map[string]int)
+
+	return func(ctx context.Context, target string, ss []Source) (Source, error) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		// On dry runs, the weights are accumulated on a copy.
+		cur := current
+		if IsDryRun(ctx) {
+			cur = make(map[string]int, len(ss))
+			for _, s := range ss {
+				cur[s.ID()] = current[s.ID()]
+			}
+		}
+
+		var best Source
+		total := 0
+		for _, s := range ss {
+			id := s.ID()
+			w := weight(id)
+			total += w
+			cur[id] += w
+			if best == nil || cur[id] > cur[best.ID()] {
+				best = s
+			}
+		}
+		if best == nil {
+			return nil, errors.New("weighted round robin: no source available")
+		}
+
+		cur[best.ID()] -= total
+		return best, nil
+	}
+}
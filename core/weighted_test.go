@@ -0,0 +1,76 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+)
+
+func TestWeight(t *testing.T) {
+	b := &core.Balancer{}
+	if w := b.Weight("s0"); w != 1 {
+		t.Fatalf("Unexpected default weight: wanted 1, found %d", w)
+	}
+	if err := b.SetWeight("s0", 0); err == nil {
+		t.Fatal("Unexpected nil error setting weight 0")
+	}
+	if err := b.SetWeight("s0", 3); err != nil {
+		t.Fatalf("Unexpected error setting weight: %v", err)
+	}
+	if w := b.Weight("s0"); w != 3 {
+		t.Fatalf("Unexpected weight: wanted 3, found %d", w)
+	}
+}
+
+func TestGet_weightedRoundRobin(t *testing.T) {
+	b := &core.Balancer{}
+	b.Strategy = core.WeightedRoundRobin(b.Weight)
+
+	s0 := newMock("s0")
+	s1 := newMock("s1")
+	s2 := newMock("s2")
+	b.Put(s0, s1, s2)
+	b.SetWeight("s0", 5)
+
+	// Expected sequence of a smooth weighted round robin
+	// with weights {5, 1, 1}.
+	tt := []string{"s0", "s0", "s1", "s0", "s2", "s0", "s0"}
+	for i := 0; i < 2; i++ {
+		for j, v := range tt {
+			s, err := b.Get(context.TODO(), "")
+			if err != nil {
+				t.Fatalf("%d.%d: Unexpected error while getting source: %v", i, j, err)
+			}
+			if s.ID() != v {
+				t.Fatalf("%d.%d: Unexpected source ID: wanted %v, found %v", i, j, v, s.ID())
+			}
+		}
+	}
+
+	// Blacklisted sources are skipped.
+	for i := 0; i < 3; i++ {
+		s, err := b.Get(context.TODO(), "", s0)
+		if err != nil {
+			t.Fatalf("%d: Unexpected error while getting source: %v", i, err)
+		}
+		if s.ID() == s0.ID() {
+			t.Fatalf("%d: Unexpected blacklisted source %v", i, s.ID())
+		}
+	}
+}
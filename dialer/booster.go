@@ -24,7 +24,9 @@ package dialer
 import (
 	"context"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/booster-proj/booster/core"
 	"upspin.io/log"
@@ -37,6 +39,12 @@ type Balancer interface {
 	Len() int
 }
 
+// DialReporter is an optional interface that the Balancer may implement
+// in order to be notified about the outcome of each dial attempt.
+type DialReporter interface {
+	ReportDial(id string, err error)
+}
+
 // New returns an instance of a booster dialer.
 func New(b Balancer) *Dialer {
 	return &Dialer{b: b}
@@ -54,6 +62,11 @@ type MetricsExporter interface {
 type Dialer struct {
 	b Balancer
 
+	// Timeout, if not zero, is the maximum amount of time that
+	// a single dial attempt can take before it is considered
+	// failed.
+	Timeout time.Duration
+
 	metrics struct {
 		sync.Mutex
 		exporter MetricsExporter
@@ -65,8 +78,12 @@ type Dialer struct {
 // interal balancer provided. If it fails to create a connection using a source, it
 // tries to dial it using another source, until source exhaustion. It that case,
 // only the last error received is returned.
+// The network and the values stored in `ctx`, such as the client address set
+// with core.WithClient by the socks5 server, are forwarded to the balancer,
+// which may use them to select the source.
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn net.Conn, err error) {
 	bl := make([]core.Source, 0, d.Len()) // blacklisted sources
+	ctx = core.WithNetwork(ctx, network)
 
 	// If the dialing fails, keep on trying with the other sources until exaustion.
 	for i := 0; len(bl) < d.Len(); i++ {
@@ -82,7 +99,12 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn
 
 		log.Debug.Printf("DialContext: Attempt #%d to connect to %v (source %v)", i, address, src.ID())
 
-		conn, err = src.DialContext(ctx, "tcp4", address)
+		conn, err = d.dial(ctx, src, network, address)
+		if ctx.Err() == nil {
+			// Report the outcome of the attempt only if it was not
+			// affected by the caller giving up.
+			d.reportDial(src.ID(), err)
+		}
 		if err != nil {
 			// Log this error, otherwise it will be silently skipped.
 			log.Error.Printf("Unable to dial connection to %v using source %v. Error: %v", address, src.ID(), err)
@@ -97,6 +119,30 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (conn
 	return
 }
 
+func (d *Dialer) dial(ctx context.Context, src core.Source, network, address string) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	return src.DialContext(ctx, dialNetwork(network), address)
+}
+
+// dialNetwork returns the IPv4 version of `network`, which is the
+// only one used by the sources.
+func dialNetwork(network string) string {
+	if strings.HasPrefix(network, "udp") {
+		return "udp4"
+	}
+	return "tcp4"
+}
+
+func (d *Dialer) reportDial(id string, err error) {
+	if r, ok := d.b.(DialReporter); ok {
+		r.ReportDial(id, err)
+	}
+}
+
 // Len returns the number of sources that the dialer as at it's disposal.
 func (d *Dialer) Len() int {
 	return d.b.Len()
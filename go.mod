@@ -1,7 +1,6 @@
 module github.com/booster-proj/booster
 
 require (
-	github.com/booster-proj/proxy v0.1.4
 	github.com/cenkalti/backoff v2.1.0+incompatible // indirect
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2
@@ -14,5 +13,6 @@ require (
 	golang.org/x/net v0.0.0-20190119204137-ed066c81e75e // indirect
 	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4
 	golang.org/x/sys v0.0.0-20181026064943-731415f00dce
+	gopkg.in/yaml.v3 v3.0.1
 	upspin.io v0.0.0-20181217205605-686971a7c4ba
 )
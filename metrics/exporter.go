@@ -64,6 +64,30 @@ var (
 		Name:      "port_count",
 		Help:      "Number of times a port is being used",
 	}, []string{"port", "protocol"})
+
+	breakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "breaker_state",
+		Help:      "State of the circuit breaker of a source: 0 closed, 1 open, 2 half-open",
+	}, []string{"source"})
+
+	quotaUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quota_used_bytes",
+		Help:      "Bytes transferred by a source in the current billing period",
+	}, []string{"source"})
+
+	quotaRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quota_remaining_bytes",
+		Help:      "Bytes that a source can still transfer in the current billing period",
+	}, []string{"source"})
+
+	bindHistoryEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bind_history_events_total",
+		Help:      "Number of bind history lookups that hit or missed, and of entries evicted",
+	}, []string{"event"})
 )
 
 func init() {
@@ -73,6 +97,10 @@ func init() {
 	prometheus.MustRegister(countConn)
 	prometheus.MustRegister(addLatency)
 	prometheus.MustRegister(countPort)
+	prometheus.MustRegister(breakerState)
+	prometheus.MustRegister(quotaUsed)
+	prometheus.MustRegister(quotaRemaining)
+	prometheus.MustRegister(bindHistoryEvents)
 }
 
 // Exporter can be used to both capture and serve metrics.
@@ -121,3 +149,20 @@ func (exp *Exporter) AddLatency(labels map[string]string, d time.Duration) {
 func (exp *Exporter) CountPort(labels map[string]string, val int) {
 	countPort.With(prometheus.Labels(labels)).Add(float64(val))
 }
+
+// SetBreakerState updates the state of the circuit breaker of a source.
+func (exp *Exporter) SetBreakerState(labels map[string]string, state int) {
+	breakerState.With(prometheus.Labels(labels)).Set(float64(state))
+}
+
+// SetQuota updates the bytes used and remaining in the quota of a source.
+func (exp *Exporter) SetQuota(labels map[string]string, used, remaining int64) {
+	quotaUsed.With(prometheus.Labels(labels)).Set(float64(used))
+	quotaRemaining.With(prometheus.Labels(labels)).Set(float64(remaining))
+}
+
+// IncBindHistoryEvent is used to update the number of bind history events,
+// i.e. hits, misses and evictions.
+func (exp *Exporter) IncBindHistoryEvent(labels map[string]string) {
+	bindHistoryEvents.With(prometheus.Labels(labels)).Inc()
+}
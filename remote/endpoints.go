@@ -16,24 +16,37 @@
 package remote
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/booster-proj/booster/core"
 	"github.com/booster-proj/booster/store"
 	"github.com/gorilla/mux"
 )
 
-func makeHealthCheckHandler(info BoosterInfo) http.HandlerFunc {
+func makeHealthCheckHandler(info BoosterInfo, s *store.SourceStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var activeTier *int
+		if s != nil {
+			if t, ok := s.ActiveTier(); ok {
+				activeTier = &t
+			}
+		}
+
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/json")
 
 		json.NewEncoder(w).Encode(struct {
-			Alive bool `json:"alive"`
+			Alive      bool `json:"alive"`
+			ActiveTier *int `json:"active_tier,omitempty"`
 			BoosterInfo
 		}{
 			Alive:       true,
+			ActiveTier:  activeTier,
 			BoosterInfo: info,
 		})
 	}
@@ -52,19 +65,137 @@ func makeSourcesHandler(s *store.SourceStore) http.HandlerFunc {
 	}
 }
 
+// WeightInput describes the fields required by `PUT` requests to
+// the `/sources/{id}/weight.json` endpoint.
+type WeightInput struct {
+	Weight int `json:"weight"`
+}
+
+func makeSourcesWeightHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		id := mux.Vars(r)["id"]
+		var payload WeightInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := s.SetWeight(id, payload.Weight); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// TierInput describes the fields required by `PUT` requests to
+// the `/sources/{id}/tier.json` endpoint.
+type TierInput struct {
+	Tier int `json:"tier"`
+}
+
+func makeSourcesTierHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		id := mux.Vars(r)["id"]
+		var payload TierInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := s.SetTier(id, payload.Tier); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// StrategyInput describes the fields required by `PUT` requests to
+// the `/strategy.json` endpoint.
+type StrategyInput struct {
+	Strategy string `json:"strategy"`
+}
+
+func makeStrategyHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(struct {
+			Strategy  string   `json:"strategy"`
+			Available []string `json:"available"`
+		}{
+			Strategy:  s.StrategyName(),
+			Available: core.Strategies(),
+		})
+	}
+}
+
+func makeStrategyUpdateHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload StrategyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.Strategy == "" {
+			writeError(w, fmt.Errorf("validation error: strategy cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		if err := s.UseStrategy(payload.Strategy); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(payload)
+	}
+}
+
 func makePoliciesHandler(s *store.SourceStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Type", "application/json")
 
+		pp := s.GetPoliciesSnapshot()
+		acc := make([]interface{}, 0, len(pp))
+		for _, p := range pp {
+			acc = append(acc, policyStatus(s, p))
+		}
 		json.NewEncoder(w).Encode(struct {
-			Policies []store.Policy `json:"policies"`
+			Policies []interface{} `json:"policies"`
 		}{
-			Policies: s.GetPoliciesSnapshot(),
+			Policies: acc,
 		})
 	}
 }
 
+// policyStatus returns the JSON representation of `p`, enriched with
+// whether it is currently in effect and, if it expires, its remaining
+// lifetime in seconds.
+func policyStatus(s *store.SourceStore, p store.Policy) interface{} {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return p
+	}
+	var acc map[string]interface{}
+	if err := json.Unmarshal(data, &acc); err != nil {
+		return p
+	}
+
+	active, remaining, expires := s.Lifetime(p)
+	acc["active"] = active
+	if expires {
+		acc["remaining"] = int64(remaining / time.Second)
+	}
+	return acc
+}
+
 func makePoliciesDelHandler(s *store.SourceStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
@@ -78,6 +209,129 @@ func makePoliciesDelHandler(s *store.SourceStore) http.HandlerFunc {
 	}
 }
 
+func makePoliciesPatchHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var patch map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		// The issuer of the patch is the issuer of the change,
+		// while the policy keeps the one that created it.
+		var issuer string
+		if raw, ok := patch["issuer"]; ok {
+			if err := json.Unmarshal(raw, &issuer); err != nil {
+				writeError(w, fmt.Errorf("validation error: issuer must be a string"), http.StatusBadRequest)
+				return
+			}
+			delete(patch, "issuer")
+		}
+
+		id := mux.Vars(r)["id"]
+		found := false
+		for _, p := range s.GetPoliciesSnapshot() {
+			found = found || p.ID() == id
+		}
+		if !found {
+			writeError(w, fmt.Errorf("source store: no %s policy found", id), http.StatusNotFound)
+			return
+		}
+		p, err := s.UpdatePolicy(id, issuer, func(rec store.PolicyRecord) (store.PolicyRecord, error) {
+			return mergePatch(rec, patch)
+		})
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// mergePatch applies `patch` to `rec` as a JSON merge patch (RFC 7396):
+// the fields present in the patch replace the ones of the record, and
+// the ones set to null are cleared.
+func mergePatch(rec store.PolicyRecord, patch map[string]json.RawMessage) (store.PolicyRecord, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return rec, err
+	}
+	for k, v := range patch {
+		if string(v) == "null" {
+			delete(fields, k)
+			continue
+		}
+		fields[k] = v
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return rec, err
+	}
+
+	var patched store.PolicyRecord
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		return rec, fmt.Errorf("validation error: %v", err)
+	}
+	return patched, nil
+}
+
+type PriorityInput struct {
+	Priority int `json:"priority"`
+}
+
+func makePoliciesPriorityHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload PriorityInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		id := mux.Vars(r)["id"]
+		if err := s.SetPriorities(map[string]int{id: payload.Priority}); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type PrioritiesInput struct {
+	// Priorities maps policy identifiers to their new priority.
+	Priorities map[string]int `json:"priorities"`
+}
+
+func makePoliciesPrioritiesHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload PrioritiesInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if len(payload.Priorities) == 0 {
+			writeError(w, fmt.Errorf("validation error: priorities cannot be empty"), http.StatusBadRequest)
+			return
+		}
+
+		if err := s.SetPriorities(payload.Priorities); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 // PoliciesInput describes the fields required by most `POST` requests
 // to a `/policies/...` endpoint.
 type PoliciesInput struct {
@@ -85,6 +339,38 @@ type PoliciesInput struct {
 	Target   string `json:"target"`
 	Reason   string `json:"reason"`
 	Issuer   string `json:"issuer"`
+
+	// Network, Ports and Clients restrict the connections affected
+	// by the policies that support them. Clients are the IP addresses
+	// or CIDR ranges of the proxy clients that opened the connections.
+	Network string            `json:"network"`
+	Ports   []store.PortRange `json:"ports"`
+	Clients []string          `json:"clients"`
+
+	// TTL, e.g. "1h", or ExpiresAt make the policy expire.
+	// Window restricts the policy to a daily time window,
+	// e.g. "01:00-05:00".
+	TTL       string        `json:"ttl"`
+	ExpiresAt *time.Time    `json:"expires_at"`
+	Window    *store.Window `json:"window"`
+
+	// Priority and Effect, either "allow" or "deny", tell in
+	// which order the policy is evaluated and what it does to
+	// the connections it matches.
+	Priority int    `json:"priority"`
+	Effect   string `json:"effect"`
+}
+
+func (in PoliciesInput) match() (store.Match, error) {
+	if err := store.ValidateNetwork(in.Network); err != nil {
+		return store.Match{}, err
+	}
+	for _, v := range in.Clients {
+		if err := store.ValidateClient(v); err != nil {
+			return store.Match{}, err
+		}
+	}
+	return store.Match{Network: in.Network, Ports: in.Ports, Clients: in.Clients}, nil
 }
 
 func makePoliciesBlockHandler(s *store.SourceStore) http.HandlerFunc {
@@ -102,7 +388,7 @@ func makePoliciesBlockHandler(s *store.SourceStore) http.HandlerFunc {
 
 		p := store.NewBlockPolicy(payload.Issuer, payload.SourceID)
 		p.Reason = payload.Reason
-		handlePolicy(s, p, w, r)
+		handlePolicy(s, p, payload, w, r)
 	}
 }
 
@@ -116,7 +402,8 @@ func makePoliciesStickyHandler(s *store.SourceStore) http.HandlerFunc {
 		}
 
 		p := store.NewStickyPolicy(payload.Issuer, s.QueryBindHistory)
-		handlePolicy(s, p, w, r)
+		p.PeekBindHistory = s.PeekBindHistory
+		handlePolicy(s, p, payload, w, r)
 	}
 }
 
@@ -141,10 +428,16 @@ func makePoliciesReserveHandler(s *store.SourceStore) http.HandlerFunc {
 			writeError(w, fmt.Errorf("validation error: hosts cannot be empty list"), http.StatusBadRequest)
 			return
 		}
+		for _, v := range payload.Hosts {
+			if err := store.ValidateHostPattern(v); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
 
 		p := store.NewReservedPolicy(payload.Issuer, payload.SourceID, payload.Hosts...)
 		p.Reason = payload.Reason
-		handlePolicy(s, p, w, r)
+		handlePolicy(s, p, payload.PoliciesInput, w, r)
 	}
 }
 
@@ -160,18 +453,247 @@ func makePoliciesAvoidHandler(s *store.SourceStore) http.HandlerFunc {
 			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
 			return
 		}
-		if payload.Target == "" {
+		m, err := payload.match()
+		if err != nil {
+			writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+			return
+		}
+		if payload.Target == "" && m.IsZero() {
 			writeError(w, fmt.Errorf("validation error: target cannot be empty"), http.StatusBadRequest)
 			return
 		}
+		if payload.Target != "" {
+			if err := store.ValidateHostPattern(payload.Target); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
 
-		p := store.NewAvoidPolicy(payload.Issuer, payload.SourceID, payload.Target)
+		p := store.NewPortAvoidPolicy(payload.Issuer, payload.SourceID, payload.Target, m)
 		p.Reason = payload.Reason
-		handlePolicy(s, p, w, r)
+		handlePolicy(s, p, payload, w, r)
 	}
 }
 
-func handlePolicy(s *store.SourceStore, p store.Policy, w http.ResponseWriter, r *http.Request) {
+func makePoliciesRouteHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload ReservedPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.SourceID == "" {
+			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		m, err := payload.match()
+		if err != nil {
+			writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(payload.Hosts) == 0 && m.IsZero() {
+			writeError(w, fmt.Errorf("validation error: either hosts, network, ports or clients are required"), http.StatusBadRequest)
+			return
+		}
+		for _, v := range payload.Hosts {
+			if err := store.ValidateHostPattern(v); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		p := store.NewRoutePolicy(payload.Issuer, payload.SourceID, m, payload.Hosts...)
+		p.Reason = payload.Reason
+		handlePolicy(s, p, payload.PoliciesInput, w, r)
+	}
+}
+
+type QuotaPolicyInput struct {
+	ReservedPolicyInput
+	// Budget is the number of bytes allowed in each
+	// billing period, which starts on ResetDay, or on
+	// the first day of the month when ResetDay is 0.
+	Budget   int64 `json:"budget"`
+	ResetDay int   `json:"reset_day"`
+}
+
+func makePoliciesQuotaHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload QuotaPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if payload.SourceID == "" {
+			writeError(w, fmt.Errorf("validation error: source_id cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		if payload.Budget <= 0 {
+			writeError(w, fmt.Errorf("validation error: budget must be positive"), http.StatusBadRequest)
+			return
+		}
+		if payload.ResetDay < 0 || payload.ResetDay > 28 {
+			writeError(w, fmt.Errorf("validation error: reset_day must be between 1 and 28, or 0 for the first day of the month"), http.StatusBadRequest)
+			return
+		}
+		for _, v := range payload.Hosts {
+			if err := store.ValidateHostPattern(v); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		p := store.NewQuotaPolicy(payload.Issuer, payload.SourceID, payload.Budget, payload.ResetDay, s.QueryUsage, payload.Hosts...)
+		p.Clock = s.Now
+		p.Reason = payload.Reason
+		handlePolicy(s, p, payload.PoliciesInput, w, r)
+	}
+}
+
+func makeExplainHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		target := q.Get("target")
+		if target == "" {
+			writeError(w, fmt.Errorf("validation error: target cannot be empty"), http.StatusBadRequest)
+			return
+		}
+		ctx := r.Context()
+		if network := q.Get("network"); network != "" {
+			if err := store.ValidateNetwork(network); err != nil {
+				writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+				return
+			}
+			ctx = core.WithNetwork(ctx, network)
+		}
+		if client := q.Get("client"); client != "" {
+			if net.ParseIP(store.TrimPort(client)) == nil {
+				writeError(w, fmt.Errorf("validation error: invalid client address %q", client), http.StatusBadRequest)
+				return
+			}
+			ctx = core.WithClient(ctx, client)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Explain(ctx, target))
+	}
+}
+
+func makePoliciesExportHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		enc.Encode(s.ExportPolicies())
+	}
+}
+
+func makePoliciesImportHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = store.ImportMerge
+		}
+		if mode != store.ImportMerge && mode != store.ImportReplace {
+			writeError(w, fmt.Errorf("validation error: mode must be either %s or %s", store.ImportMerge, store.ImportReplace), http.StatusBadRequest)
+			return
+		}
+		var payload store.PolicyDocument
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.ImportPolicies(payload, mode); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func makePoliciesHistoryHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var since, until time.Time
+		for _, v := range []struct {
+			name string
+			t    *time.Time
+		}{{"since", &since}, {"until", &until}} {
+			if raw := q.Get(v.name); raw != "" {
+				t, err := time.Parse(time.RFC3339, raw)
+				if err != nil {
+					writeError(w, fmt.Errorf("validation error: %s must be an RFC 3339 time: %v", v.name, err), http.StatusBadRequest)
+					return
+				}
+				*v.t = t
+			}
+		}
+
+		entries, err := s.QueryAudit(since, until)
+		if err != nil {
+			writeError(w, err, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Entries []store.AuditEntry `json:"entries"`
+		}{
+			Entries: entries,
+		})
+	}
+}
+
+func makeQuotasHandler(s *store.SourceStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+
+		quotas := s.Quotas()
+		if quotas == nil {
+			quotas = []store.QuotaStatus{}
+		}
+		json.NewEncoder(w).Encode(struct {
+			Quotas []store.QuotaStatus `json:"quotas"`
+		}{
+			Quotas: quotas,
+		})
+	}
+}
+
+func handlePolicy(s *store.SourceStore, p store.Policy, in PoliciesInput, w http.ResponseWriter, r *http.Request) {
+	expiresAt := in.ExpiresAt
+	if in.TTL != "" {
+		ttl, err := time.ParseDuration(in.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, fmt.Errorf("validation error: invalid ttl %q", in.TTL), http.StatusBadRequest)
+			return
+		}
+		if expiresAt != nil {
+			writeError(w, fmt.Errorf("validation error: ttl and expires_at cannot be used together"), http.StatusBadRequest)
+			return
+		}
+		at := s.Now().Add(ttl)
+		expiresAt = &at
+	}
+	if tb, ok := p.(store.TimeBound); ok {
+		tb.SetSchedule(expiresAt, in.Window)
+	}
+	effect, err := store.ParseEffect(in.Effect)
+	if err != nil {
+		writeError(w, fmt.Errorf("validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if rp, ok := p.(store.Ranked); ok {
+		rp.SetRank(in.Priority, effect)
+	}
+
 	if err := s.AppendPolicy(p); err != nil {
 		writeError(w, err, http.StatusBadRequest)
 		return
@@ -64,17 +64,33 @@ func NewRouter() *Router {
 // properly.
 func (r *Router) SetupRoutes() {
 	router := r.r
-	router.HandleFunc("/health.json", makeHealthCheckHandler(r.Info))
+	router.HandleFunc("/health.json", makeHealthCheckHandler(r.Info, r.Store))
 	if store := r.Store; store != nil {
 		router.HandleFunc("/sources.json", makeSourcesHandler(store))
+		router.HandleFunc("/sources/{id}/weight.json", makeSourcesWeightHandler(store)).Methods("PUT")
+		router.HandleFunc("/sources/{id}/tier.json", makeSourcesTierHandler(store)).Methods("PUT")
+
+		router.HandleFunc("/strategy.json", makeStrategyHandler(store)).Methods("GET")
+		router.HandleFunc("/strategy.json", makeStrategyUpdateHandler(store)).Methods("PUT")
 
 		router.HandleFunc("/policies.json", makePoliciesHandler(store))
+		router.HandleFunc("/policies/history.json", makePoliciesHistoryHandler(store)).Methods("GET")
+		router.HandleFunc("/policies/export", makePoliciesExportHandler(store)).Methods("GET")
+		router.HandleFunc("/policies/import", makePoliciesImportHandler(store)).Methods("POST")
 		router.HandleFunc("/policies/{id}.json", makePoliciesDelHandler(store)).Methods("DELETE")
+		router.HandleFunc("/policies/{id}.json", makePoliciesPatchHandler(store)).Methods("PATCH")
+		router.HandleFunc("/policies/{id}/priority.json", makePoliciesPriorityHandler(store)).Methods("PUT")
+		router.HandleFunc("/policies/priorities.json", makePoliciesPrioritiesHandler(store)).Methods("PUT")
 
 		router.HandleFunc("/policies/block.json", makePoliciesBlockHandler(store)).Methods("POST")
 		router.HandleFunc("/policies/sticky.json", makePoliciesStickyHandler(store)).Methods("POST")
 		router.HandleFunc("/policies/reserve.json", makePoliciesReserveHandler(store)).Methods("POST")
 		router.HandleFunc("/policies/avoid.json", makePoliciesAvoidHandler(store)).Methods("POST")
+		router.HandleFunc("/policies/route.json", makePoliciesRouteHandler(store)).Methods("POST")
+		router.HandleFunc("/policies/quota.json", makePoliciesQuotaHandler(store)).Methods("POST")
+
+		router.HandleFunc("/quotas.json", makeQuotasHandler(store)).Methods("GET")
+		router.HandleFunc("/explain.json", makeExplainHandler(store)).Methods("GET")
 	}
 	if handler := r.MetricsProvider; handler != nil {
 		router.Handle("/metrics", handler)
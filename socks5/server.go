@@ -0,0 +1,294 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package socks5 provides a SOCKS5 proxy server which dials the
+// connections requested by its clients with a booster dialer.
+// Each dial carries the address of the client that requested it,
+// see core.WithClient, so that policies may select the source
+// of the connection depending on the device that opened it.
+//
+// Only the CONNECT command without authentication is supported.
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/booster-proj/booster/core"
+	"upspin.io/log"
+)
+
+const (
+	version = 5
+
+	methodNoAuth       = 0
+	methodNoAcceptable = 0xff
+
+	cmdConnect = 1
+
+	atypIPv4   = 1
+	atypDomain = 3
+	atypIPv6   = 4
+)
+
+// Reply codes, as defined in RFC 1928.
+const (
+	repSucceeded           = 0
+	repGeneralFailure      = 1
+	repNetworkUnreachable  = 3
+	repHostUnreachable     = 4
+	repConnectionRefused   = 5
+	repCommandNotSupported = 7
+	repAddrNotSupported    = 8
+)
+
+// Dialer is the interface used by the server to dial the
+// connections requested by its clients.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Server is a SOCKS5 proxy server. DialWith must be called
+// before serving any connection.
+type Server struct {
+	d Dialer
+}
+
+// New returns a new SOCKS5 server.
+func New() *Server {
+	return &Server{}
+}
+
+// DialWith makes the server use d to dial the connections
+// requested by its clients.
+func (s *Server) DialWith(d Dialer) {
+	s.d = d
+}
+
+// Protocol returns the protocol spoken by the server.
+func (s *Server) Protocol() string {
+	return "socks5"
+}
+
+// ListenAndServe listens on the TCP port provided and serves the
+// incoming connections until ctx is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts the connections coming from l, serving each one of them
+// in its own goroutine, until ctx is cancelled. The listener is closed
+// when Serve returns.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		conn.Close()
+	}()
+
+	if err := s.handle(ctx, conn); err != nil {
+		log.Debug.Printf("SOCKS5: connection from %v: %v", conn.RemoteAddr(), err)
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) error {
+	if err := negotiate(conn); err != nil {
+		return err
+	}
+
+	cmd, address, err := readRequest(conn)
+	if err != nil {
+		if errors.Is(err, errAddrNotSupported) {
+			writeReply(conn, repAddrNotSupported, nil)
+		}
+		return err
+	}
+	if cmd != cmdConnect {
+		writeReply(conn, repCommandNotSupported, nil)
+		return fmt.Errorf("command %d not supported", cmd)
+	}
+
+	ctx = core.WithClient(ctx, conn.RemoteAddr().String())
+	tconn, err := s.d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		writeReply(conn, replyCode(err), nil)
+		return fmt.Errorf("unable to dial %v: %v", address, err)
+	}
+	defer tconn.Close()
+
+	if err := writeReply(conn, repSucceeded, tconn.LocalAddr()); err != nil {
+		return err
+	}
+
+	errc := make(chan error, 2)
+	go pipe(tconn, conn, errc)
+	go pipe(conn, tconn, errc)
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pipe copies src into dst, closing the write side of dst, when
+// supported, once src is drained.
+func pipe(dst, src net.Conn, errc chan<- error) {
+	_, err := io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+	errc <- err
+}
+
+// negotiate reads the methods proposed by the client and
+// selects the "no authentication required" one.
+func negotiate(rw io.ReadWriter) error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != version {
+		return fmt.Errorf("version %d not supported", hdr[0])
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(rw, methods); err != nil {
+		return err
+	}
+	for _, m := range methods {
+		if m == methodNoAuth {
+			_, err := rw.Write([]byte{version, methodNoAuth})
+			return err
+		}
+	}
+	rw.Write([]byte{version, methodNoAcceptable})
+	return errors.New("no acceptable authentication method")
+}
+
+var errAddrNotSupported = errors.New("address type not supported")
+
+// readRequest reads the request of the client, returning the command
+// and the destination address.
+func readRequest(r io.Reader) (byte, string, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, "", err
+	}
+	if hdr[0] != version {
+		return 0, "", fmt.Errorf("version %d not supported", hdr[0])
+	}
+
+	var host string
+	switch hdr[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if hdr[3] == atypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return 0, "", err
+		}
+		host = ip.String()
+	case atypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return 0, "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return 0, "", err
+		}
+		host = string(name)
+	default:
+		return 0, "", errAddrNotSupported
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return 0, "", err
+	}
+	return hdr[1], net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeReply writes a reply with code rep to w. addr is the address
+// bound by the server, which is sent zeroed if it is not a TCP address.
+func writeReply(w io.Writer, rep byte, addr net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	if a, ok := addr.(*net.TCPAddr); ok {
+		ip, port = a.IP, a.Port
+	}
+	b := []byte{version, rep, 0}
+	if ip4 := ip.To4(); ip4 != nil {
+		b = append(b, atypIPv4)
+		b = append(b, ip4...)
+	} else {
+		b = append(b, atypIPv6)
+		b = append(b, ip.To16()...)
+	}
+	b = append(b, byte(port>>8), byte(port))
+	_, err := w.Write(b)
+	return err
+}
+
+// replyCode returns the reply code describing the dial error err.
+func replyCode(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return repConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return repNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return repHostUnreachable
+	default:
+		return repGeneralFailure
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package socks5_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/dialer"
+	"github.com/booster-proj/booster/socks5"
+	"github.com/booster-proj/booster/store"
+)
+
+// dials counts the connections dialed by each source.
+type dials struct {
+	sync.Mutex
+	n map[string]int
+}
+
+type source struct {
+	id    string
+	dials *dials
+}
+
+func (s *source) ID() string {
+	return s.id
+}
+
+func (s *source) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	s.dials.Lock()
+	s.dials.n[s.id]++
+	s.dials.Unlock()
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func (s *source) Close() error {
+	return nil
+}
+
+func echo(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+// connect opens a connection to target through the SOCKS5
+// server listening on proxy.
+func connect(t *testing.T, proxy, target string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp4", proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[1] != 0 {
+		t.Fatalf("Unexpected method selected: %d", resp[1])
+	}
+
+	taddr, err := net.ResolveTCPAddr("tcp4", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := append([]byte{5, 1, 0, 1}, taddr.IP.To4()...)
+	req = append(req, byte(taddr.Port>>8), byte(taddr.Port))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	resp = make([]byte, 10)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[1] != 0 {
+		t.Fatalf("Unexpected reply code: %d", resp[1])
+	}
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	resp = make([]byte, 4)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "ping" {
+		t.Fatalf("Unexpected echo: %q", resp)
+	}
+}
+
+func TestServer(t *testing.T) {
+	target := echo(t)
+	defer target.Close()
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := socks5.New()
+	srv.DialWith(new(net.Dialer))
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ctx, l)
+	}()
+
+	for i := 0; i < 2; i++ {
+		connect(t, l.Addr().String(), target.Addr().String())
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Unexpected error while serving: %v", err)
+	}
+}
+
+func TestServer_clientPolicy(t *testing.T) {
+	target := echo(t)
+	defer target.Close()
+
+	d := &dials{n: make(map[string]int)}
+	s := store.New(new(core.Balancer))
+	s.Put(&source{id: "eth0", dials: d}, &source{id: "wwan0", dials: d})
+
+	// A policy for another client does not affect the connections.
+	p := store.NewRoutePolicy("test", "wwan0", store.Match{Clients: []string{"192.168.1.50"}})
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := socks5.New()
+	srv.DialWith(dialer.New(s))
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ctx, l)
+	}()
+
+	for i := 0; i < 4; i++ {
+		connect(t, l.Addr().String(), target.Addr().String())
+	}
+	d.Lock()
+	if d.n["eth0"] == 0 || d.n["wwan0"] == 0 {
+		t.Fatalf("Unexpected dials without a policy for the client: %v", d.n)
+	}
+	d.n = make(map[string]int)
+	d.Unlock()
+
+	// The client address of the proxy connection reaches the policies.
+	p = store.NewRoutePolicy("test", "wwan0", store.Match{Clients: []string{"127.0.0.1"}})
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		connect(t, l.Addr().String(), target.Addr().String())
+	}
+	d.Lock()
+	if d.n["eth0"] != 0 || d.n["wwan0"] != 4 {
+		t.Fatalf("Unexpected dials with a policy for the client: %v", d.n)
+	}
+	d.Unlock()
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Unexpected error while serving: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source
+
+import (
+	"fmt"
+	"path"
+	"sync"
+)
+
+// Filter decides which network interfaces may be used as sources, matching
+// their names against shell patterns, using the syntax of path.Match. The
+// zero value accepts every interface. It is safe for concurrent use, so that
+// its rules can be updated while the listener is running.
+type Filter struct {
+	mux     sync.RWMutex
+	include []string
+	exclude []string
+}
+
+// NewFilter returns a Filter configured with `include` and `exclude` patterns.
+func NewFilter(include, exclude []string) (*Filter, error) {
+	f := new(Filter)
+	if err := f.Update(include, exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Update replaces the rules of the filter. When `include` is empty, every
+// interface that is not excluded is accepted. The old rules are kept if
+// one of the patterns is malformed.
+func (f *Filter) Update(include, exclude []string) error {
+	for _, v := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(v, ""); err != nil {
+			return fmt.Errorf("filter: invalid pattern %q: %v", v, err)
+		}
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.include = append([]string{}, include...)
+	f.exclude = append([]string{}, exclude...)
+	return nil
+}
+
+// Rules returns a copy of the include and exclude patterns of the filter.
+func (f *Filter) Rules() (include, exclude []string) {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return append([]string{}, f.include...), append([]string{}, f.exclude...)
+}
+
+// Allow reports whether the interface called `name` may be used. Exclude
+// rules win over include rules. A nil Filter accepts every interface.
+func (f *Filter) Allow(name string) bool {
+	if f == nil {
+		return true
+	}
+
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	for _, v := range f.exclude {
+		if ok, _ := path.Match(v, name); ok {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, v := range f.include {
+		if ok, _ := path.Match(v, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package source_test
+
+import (
+	"testing"
+
+	"github.com/booster-proj/booster/source"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := source.NewFilter([]string{"en*", "wwan0"}, []string{"en1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name string
+		out  bool
+	}{
+		{name: "en0", out: true},
+		{name: "en1", out: false},
+		{name: "wwan0", out: true},
+		{name: "wwan1", out: false},
+		{name: "docker0", out: false},
+	}
+	for i, v := range tt {
+		if ok := f.Allow(v.name); ok != v.out {
+			t.Fatalf("%d: Unexpected Allow(%s): wanted %v, found %v", i, v.name, v.out, ok)
+		}
+	}
+
+	if err := f.Update([]string{"["}, nil); err == nil {
+		t.Fatal("Update should fail with malformed patterns")
+	}
+	if !f.Allow("en0") {
+		t.Fatal("A failed update should keep the old rules")
+	}
+
+	if err := f.Update(nil, []string{"docker*"}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allow("wwan1") || f.Allow("docker0") {
+		t.Fatal("Filter without include rules should accept everything that is not excluded")
+	}
+
+	var nf *source.Filter
+	if !nf.Allow("docker0") {
+		t.Fatal("A nil filter should accept every interface")
+	}
+}
@@ -20,12 +20,18 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	"github.com/booster-proj/booster/core"
 )
 
 // DialHook describes the function used to notify about
 // dial errors.
 type DialHook func(ref, network, address string, err error)
 
+// DataFlowHook describes the function used to notify about
+// data transmitted through a source.
+type DataFlowHook func(ref string, data *DataFlow)
+
 // MetricsExporter is the entity used to send data tranmission
 // information and connection count to an entity that is supposed
 // to persist or handle the data accordingly.
@@ -47,12 +53,21 @@ type Interface struct {
 	// dialer is not able to create a network connection.
 	OnDialErr DialHook
 
+	// If OnDataFlow is not nil, it is called each time that data
+	// is transmitted through one of the connections of the interface.
+	OnDataFlow DataFlowHook
+
 	metrics struct {
 		sync.Mutex
 		exporter MetricsExporter
 	}
 
 	conns *conns
+
+	// Moving averages of the time required to dial a connection
+	// and to receive its first byte of data.
+	connLatency      core.EWMA
+	firstByteLatency core.EWMA
 }
 
 // SetMetricsExporter sets exp as the default MetricsExporter of interface
@@ -76,6 +91,7 @@ func (i *Interface) ID() string {
 func (i *Interface) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	// Implementations of the `dialContext` function can be found
 	// in the {darwin, linux, windows}_dial.go files.
+	start := time.Now()
 	conn, err := i.dialContext(ctx, network, address)
 	if err != nil {
 		if f := i.OnDialErr; f != nil {
@@ -83,6 +99,7 @@ func (i *Interface) DialContext(ctx context.Context, network, address string) (n
 		}
 		return nil, err
 	}
+	i.connLatency.Add(float64(time.Since(start)))
 
 	return i.Follow(conn), nil
 }
@@ -128,9 +145,13 @@ func (i *Interface) Follow(conn net.Conn) net.Conn {
 		if started && !received {
 			received = true
 			d := time.Since(t0)
+			i.firstByteLatency.Add(float64(d))
 			i.SendAddLatency(labels, d)
 		}
 		i.SendDataFlow(labels, data)
+		if f := i.OnDataFlow; f != nil {
+			f(i.ID(), data)
+		}
 	}
 	wconn.OnWrite = func(data *DataFlow) {
 		if !started {
@@ -138,6 +159,9 @@ func (i *Interface) Follow(conn net.Conn) net.Conn {
 			t0 = time.Now()
 		}
 		i.SendDataFlow(labels, data)
+		if f := i.OnDataFlow; f != nil {
+			f(i.ID(), data)
+		}
 	}
 	if i.conns == nil {
 		i.conns = &conns{}
@@ -194,6 +218,14 @@ func (i *Interface) SendDataFlow(labels map[string]string, data *DataFlow) {
 	i.metrics.exporter.SendDataFlow(labels, data)
 }
 
+// Latency returns the sum of the average time required to dial a
+// new connection and the average time required to receive the first
+// byte of data, once the connection is established. It implements
+// core.LatencyReporter.
+func (i *Interface) Latency() time.Duration {
+	return time.Duration(i.connLatency.Value() + i.firstByteLatency.Value())
+}
+
 // Close closes all open connections.
 func (i *Interface) Close() error {
 	i.conns.Close()
@@ -61,6 +61,14 @@ type Config struct {
 	Store           Store
 	Provider        Provider
 	MetricsExporter MetricsExporter
+	OnDataFlow      DataFlowHook
+
+	// Filter selects the network interfaces that may be used
+	// as sources. Ignored when Provider is set.
+	Filter *Filter
+	// CheckTargets are the addresses dialed to check the internet
+	// connection of the interfaces. Ignored when Provider is set.
+	CheckTargets []string
 }
 
 // NewListener creates a new Listener with the provided storage, using
@@ -71,8 +79,11 @@ func NewListener(c Config) *Listener {
 	var p Provider = &MergedProvider{
 		ControlInterface: func(ifi *Interface) {
 			ifi.OnDialErr = hooker.HandleDialErr
+			ifi.OnDataFlow = c.OnDataFlow
 			ifi.SetMetricsExporter(c.MetricsExporter)
 		},
+		Filter:       c.Filter,
+		CheckTargets: c.CheckTargets,
 	}
 	if c.Provider != nil {
 		p = c.Provider
@@ -24,7 +24,20 @@ import (
 	"upspin.io/log"
 )
 
+// DefaultCheckTargets is the list of addresses used to check whether
+// an interface provides an internet connection, when none is configured.
+var DefaultCheckTargets = []string{"google.com:80"}
+
 type Local struct {
+	// Filter selects the interfaces that may be provided. If nil,
+	// every interface is taken into consideration.
+	Filter *Filter
+
+	// Targets is the list of "host:port" addresses that are dialed
+	// to check the internet connection of an interface. The check
+	// succeeds as soon as one of them is reachable. Defaults to
+	// DefaultCheckTargets.
+	Targets []string
 }
 
 func (l *Local) Provide(ctx context.Context, level Confidence) ([]*Interface, error) {
@@ -35,6 +48,9 @@ func (l *Local) Provide(ctx context.Context, level Confidence) ([]*Interface, er
 
 	interfaces := make([]*Interface, 0, len(ift))
 	for _, ifi := range ift {
+		if !l.Filter.Allow(ifi.Name) {
+			continue
+		}
 		if s := l.filter(&Interface{ifi: ifi}, level); s != nil {
 			interfaces = append(interfaces, s)
 		}
@@ -46,12 +62,21 @@ func (l *Local) Provide(ctx context.Context, level Confidence) ([]*Interface, er
 func (l *Local) Check(ctx context.Context, ifi *Interface, level Confidence) error {
 	checks := []check{hasHardwareAddr, hasIP}
 	if level == High {
-		checks = append(checks, hasNetworkConnRetry)
+		checks = append(checks, func(ctx context.Context, ifi *Interface) error {
+			return hasNetworkConnRetry(ctx, ifi, l.targets())
+		})
 	}
 
 	return pipeline(ctx, ifi, checks...)
 }
 
+func (l *Local) targets() []string {
+	if len(l.Targets) == 0 {
+		return DefaultCheckTargets
+	}
+	return l.Targets
+}
+
 func (l *Local) filter(ifi *Interface, level Confidence) *Interface {
 	if err := l.Check(context.Background(), ifi, level); err != nil {
 		log.Debug.Printf("Local provider: pipeline with confidence (%d): %v", level, err)
@@ -110,26 +135,36 @@ func hasIP(ctx context.Context, ifi *Interface) error {
 	return nil
 }
 
-func hasNetworkConn(ctx context.Context, ifi *Interface) error {
+func hasNetworkConn(ctx context.Context, ifi *Interface, targets []string) error {
+	var err error
+	for _, target := range targets {
+		if err = dialTarget(ctx, ifi, target); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func dialTarget(ctx context.Context, ifi *Interface, target string) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*500)
 	defer cancel()
 
-	conn, err := ifi.DialContext(ctx, "tcp", "google.com:80")
+	conn, err := ifi.DialContext(ctx, "tcp", target)
 	if err != nil {
-		return fmt.Errorf("unable to dial connection using interface %s: %v", ifi.ID(), err)
+		return fmt.Errorf("unable to dial connection to %s using interface %s: %v", target, ifi.ID(), err)
 	}
 	conn.Close()
 	return nil
 }
 
-func hasNetworkConnRetry(ctx context.Context, ifi *Interface) error {
+func hasNetworkConnRetry(ctx context.Context, ifi *Interface, targets []string) error {
 	for i := 0; i < 3; i++ {
 		if i == 2 {
 			// last item
-			return hasNetworkConn(ctx, ifi)
+			return hasNetworkConn(ctx, ifi, targets)
 		}
 
-		if err := hasNetworkConn(ctx, ifi); err == nil {
+		if err := hasNetworkConn(ctx, ifi, targets); err == nil {
 			return nil
 		}
 
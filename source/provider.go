@@ -37,6 +37,11 @@ type MergedProvider struct {
 	// it is hidden inside a core.Source.
 	ControlInterface func(ifi *Interface)
 
+	// Filter and CheckTargets configure the local provider,
+	// see Local.
+	Filter       *Filter
+	CheckTargets []string
+
 	local *Local
 }
 
@@ -44,7 +49,10 @@ type MergedProvider struct {
 // by merged. Currently only a local provider is queried.
 func (p *MergedProvider) Provide(ctx context.Context) ([]core.Source, error) {
 	if p.local == nil {
-		p.local = new(Local)
+		p.local = &Local{
+			Filter:  p.Filter,
+			Targets: p.CheckTargets,
+		}
 	}
 
 	interfaces, err := p.local.Provide(ctx, Low)
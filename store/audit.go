@@ -0,0 +1,181 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"upspin.io/log"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditAdd    = "add"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditExpire = "expire"
+)
+
+// AuditEntry describes a change to the list of policies, as it is
+// recorded in the audit log. Policy is the full body of the policy,
+// and it is missing only for the policies that cannot be persisted.
+// Issuer is the issuer of the policy, except for updates, where it
+// is the issuer of the change. PreviousID is set by the updates that
+// change the identifier of the policy.
+type AuditEntry struct {
+	Time       time.Time     `json:"time"`
+	Action     string        `json:"action"`
+	PolicyID   string        `json:"policy_id"`
+	PreviousID string        `json:"previous_id,omitempty"`
+	Issuer     string        `json:"issuer"`
+	Reason     string        `json:"reason,omitempty"`
+	Policy     *PolicyRecord `json:"policy,omitempty"`
+}
+
+// PersistAudit makes the store append an entry to the file at `path` each
+// time a policy is added, updated, deleted or expires. The file is created if it does
+// not exist, and it is never truncated: each line is a JSON encoded AuditEntry.
+func (ss *SourceStore) PersistAudit(path string) error {
+	ss.audit.Lock()
+	defer ss.audit.Unlock()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("source store: unable to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	// Terminate the last line if a crash left it half written, so
+	// that it does not corrupt the next entry.
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("source store: unable to open audit log: %v", err)
+	}
+	if n := fi.Size(); n > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, n-1); err != nil {
+			return fmt.Errorf("source store: unable to read audit log: %v", err)
+		}
+		if last[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				return fmt.Errorf("source store: unable to write audit log: %v", err)
+			}
+		}
+	}
+	ss.audit.path = path
+	return nil
+}
+
+// recordAudit appends an entry with `action` for each policy of `val` to the
+// audit log, if the store is keeping one. Failures are only logged, as the
+// policies are already in effect. Must be called with the policies lock held,
+// so that entries are written in the same order of the changes.
+func (ss *SourceStore) recordAudit(action string, val ...Policy) {
+	now := ss.Now()
+	entries := make([]AuditEntry, 0, len(val))
+	for _, p := range val {
+		entries = append(entries, makeAuditEntry(now, action, p))
+	}
+	ss.writeAudit(entries...)
+}
+
+// makeAuditEntry returns the entry that records `action` on `p` at `now`.
+func makeAuditEntry(now time.Time, action string, p Policy) AuditEntry {
+	e := AuditEntry{Time: now, Action: action, PolicyID: p.ID()}
+	if r, ok := MakePolicyRecord(p); ok {
+		e.Issuer, e.Reason, e.Policy = r.Issuer, r.Reason, &r
+	}
+	return e
+}
+
+// writeAudit appends `entries` to the audit log, see recordAudit.
+func (ss *SourceStore) writeAudit(entries ...AuditEntry) {
+	ss.audit.Lock()
+	defer ss.audit.Unlock()
+
+	if ss.audit.path == "" || len(entries) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(&e); err != nil {
+			log.Error.Printf("SourceStore: unable to encode audit entry of policy %s: %v", e.PolicyID, err)
+			return
+		}
+	}
+
+	f, err := os.OpenFile(ss.audit.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		log.Error.Printf("SourceStore: unable to open audit log: %v", err)
+		return
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		log.Error.Printf("SourceStore: unable to write audit log: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Error.Printf("SourceStore: unable to write audit log: %v", err)
+	}
+}
+
+// QueryAudit returns the entries of the audit log recorded from `since`,
+// included, until `until`, excluded, in the order they were recorded. A zero
+// time leaves the range open on that side. Lines that cannot be decoded,
+// such as one left half written by a crash, are skipped.
+func (ss *SourceStore) QueryAudit(since, until time.Time) ([]AuditEntry, error) {
+	ss.audit.Lock()
+	defer ss.audit.Unlock()
+
+	if ss.audit.path == "" {
+		return nil, fmt.Errorf("source store: the audit log is not enabled")
+	}
+	f, err := os.Open(ss.audit.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []AuditEntry{}, nil
+		}
+		return nil, fmt.Errorf("source store: unable to read audit log: %v", err)
+	}
+	defer f.Close()
+
+	entries := []AuditEntry{}
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e AuditEntry
+			if jerr := json.Unmarshal(line, &e); jerr != nil {
+				log.Error.Printf("SourceStore: skipping line %d of audit log: %v", n, jerr)
+			} else if (since.IsZero() || !e.Time.Before(since)) && (until.IsZero() || e.Time.Before(until)) {
+				entries = append(entries, e)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("source store: unable to read audit log: %v", err)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,172 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	store.Resolver = resolver{}
+	c := &clock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	s := store.New(&storage{})
+	s.Clock = c.Now
+	if _, err := s.QueryAudit(time.Time{}, time.Time{}); err == nil {
+		t.Fatal("QueryAudit should fail when the audit log is not enabled")
+	}
+	if err := s.PersistAudit(path); err != nil {
+		t.Fatal(err)
+	}
+
+	bp := store.NewBlockPolicy("alice", "wwan0")
+	bp.Reason = "metered"
+	if err := s.AppendPolicy(bp); err != nil {
+		t.Fatal(err)
+	}
+	c.now = c.now.Add(time.Minute)
+	rp := store.NewReservedPolicy("bob", "eth0", "example.com")
+	at := c.now.Add(time.Hour)
+	rp.SetSchedule(&at, nil)
+	if err := s.UpdatePolicies([]string{bp.ID()}, []store.Policy{rp}); err != nil {
+		t.Fatal(err)
+	}
+	c.now = c.now.Add(time.Hour)
+	if _, err := s.PurgeExpiredPolicies(); err != nil {
+		t.Fatal(err)
+	}
+	// Failed changes are not recorded.
+	if err := s.DelPolicy(bp.ID()); err == nil {
+		t.Fatal("DelPolicy should fail on a missing policy")
+	}
+
+	entries, err := s.QueryAudit(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		action, id, issuer string
+	}{
+		{store.AuditAdd, bp.ID(), "alice"},
+		{store.AuditDelete, bp.ID(), "alice"},
+		{store.AuditAdd, rp.ID(), "bob"},
+		{store.AuditExpire, rp.ID(), "bob"},
+	}
+	if len(entries) != len(tt) {
+		t.Fatalf("Unexpected number of entries: %d: %+v", len(entries), entries)
+	}
+	for i, v := range tt {
+		e := entries[i]
+		if e.Action != v.action || e.PolicyID != v.id || e.Issuer != v.issuer {
+			t.Fatalf("%d: Unexpected entry: %+v", i, e)
+		}
+		if e.Policy == nil {
+			t.Fatalf("%d: Entry should carry the policy body", i)
+		}
+	}
+	if entries[0].Reason != "metered" || entries[0].Policy.SourceID != "wwan0" {
+		t.Fatalf("Unexpected entry: %+v, %+v", entries[0], entries[0].Policy)
+	}
+	if p := entries[2].Policy; len(p.Hosts) != 1 || p.ExpiresAt == nil {
+		t.Fatalf("Unexpected policy body: %+v", p)
+	}
+
+	// Entries are filtered by time, and survive the store.
+	s = store.New(&storage{})
+	if err := s.PersistAudit(path); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2019, 3, 1, 12, 1, 0, 0, time.UTC)
+	entries, err = s.QueryAudit(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != store.AuditDelete || entries[1].Action != store.AuditAdd {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+
+	// A line left half written is skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2019-03-01T14:00:00Z","act`)
+	f.Close()
+	if entries, err = s.QueryAudit(time.Time{}, time.Time{}); err != nil || len(entries) != 4 {
+		t.Fatalf("Unexpected entries: %v, %+v", err, entries)
+	}
+	s = store.New(&storage{})
+	if err := s.PersistAudit(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPolicy(bp); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = s.QueryAudit(time.Time{}, time.Time{}); err != nil || len(entries) != 5 {
+		t.Fatalf("Entries should be recorded after a half written line: %v, %+v", err, entries)
+	}
+}
+
+func TestAudit_update(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	if err := s.PersistAudit(filepath.Join(dir, "audit.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPolicy(store.NewBlockPolicy("alice", "wwan0")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.UpdatePolicy("block_wwan0", "bob", func(r store.PolicyRecord) (store.PolicyRecord, error) {
+		r.SourceID = "wwan1"
+		return r, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.QueryAudit(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	e := entries[1]
+	if e.Action != store.AuditUpdate || e.PolicyID != p.ID() || e.PreviousID != "block_wwan0" || e.Issuer != "bob" {
+		t.Fatalf("Unexpected update entry: %+v", e)
+	}
+	if e.Policy == nil || e.Policy.Issuer != "alice" || e.Policy.SourceID != "wwan1" {
+		t.Fatalf("Unexpected policy body: %+v", e.Policy)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Explanation describes how the store would assign a connection to a
+// target, see SourceStore.Explain.
+type Explanation struct {
+	Target  string `json:"target"`
+	Network string `json:"network"`
+	Client  string `json:"client,omitempty"`
+
+	// Sources tells, for each source, whether the policies
+	// accept it for the target.
+	Sources []SourceVerdict `json:"sources"`
+
+	// BoundTo is the source that the bind history associates
+	// with the target, if any.
+	BoundTo string `json:"bound_to,omitempty"`
+
+	// Next is the source that would receive the connection. If
+	// none would, Error tells why.
+	Next  string `json:"next,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SourceVerdict tells whether a source is accepted by the policies for a
+// target and which policy, if any, took the decision.
+type SourceVerdict struct {
+	ID       string `json:"id"`
+	Accepted bool   `json:"accepted"`
+	Policy   string `json:"policy,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Explain tells how a connection to `address` would be handled by Get,
+// without actually assigning it: which sources the policies accept and
+// which policy decided, what the bind history says and which source the
+// strategy would pick next.
+// The network and the client of the connection may be stored in `ctx`, as
+// in Get.
+func (ss *SourceStore) Explain(ctx context.Context, address string) *Explanation {
+	ctx = core.WithDryRun(ctx)
+	t := targetFromContext(ctx, address)
+	e := &Explanation{
+		Target:  address,
+		Network: t.Network,
+		Sources: []SourceVerdict{},
+	}
+	if t.Client != nil {
+		e.Client = t.Client.String()
+	}
+	var blacklisted []core.Source
+	ss.Do(func(src core.Source) {
+		ok, p := ss.shouldAccept(src.ID(), t)
+		v := SourceVerdict{ID: src.ID(), Accepted: ok}
+		if p != nil {
+			v.Policy = p.ID()
+			if b, ok := p.(interface{ base() basePolicy }); ok {
+				v.Reason = b.base().Reason
+			}
+		}
+		if !ok {
+			blacklisted = append(blacklisted, src)
+		}
+		e.Sources = append(e.Sources, v)
+	})
+	e.BoundTo, _ = ss.PeekBindHistory(t.Host)
+
+	src, err := ss.protected.Get(ctx, t.Host, blacklisted...)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	e.Next = src.ID()
+	return e
+}
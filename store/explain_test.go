@@ -0,0 +1,141 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestExplain(t *testing.T) {
+	store.Resolver = resolver{}
+	b := new(core.Balancer)
+	s := store.New(b)
+	s.Put(&mock{id: "s0"}, &mock{id: "s1"}, &mock{id: "s2"})
+
+	p := store.NewBlockPolicy("test", "s0")
+	p.Reason = "metered"
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPolicy(store.NewRoutePolicy("test", "s2", store.Match{Network: "udp"})); err != nil {
+		t.Fatal(err)
+	}
+
+	e := s.Explain(core.WithNetwork(context.TODO(), "udp4"), "example.com:27015")
+	if e.Network != "udp" {
+		t.Fatalf("Unexpected network: %v", e.Network)
+	}
+	if len(e.Sources) != 3 {
+		t.Fatalf("Unexpected sources: %+v", e.Sources)
+	}
+	want := []store.SourceVerdict{
+		{ID: "s0", Policy: "block_s0", Reason: "metered"},
+		{ID: "s1", Policy: "route_s2_for_udp"},
+		{ID: "s2", Accepted: true},
+	}
+	for i, v := range want {
+		if e.Sources[i] != v {
+			t.Fatalf("%d: Unexpected verdict: wanted %+v, found %+v", i, v, e.Sources[i])
+		}
+	}
+	if e.Next != "s2" {
+		t.Fatalf("Unexpected next source: %v (%v)", e.Next, e.Error)
+	}
+
+	// Explain does not consume the pick of the strategy.
+	e = s.Explain(context.TODO(), "example.com:443")
+	for i := 0; i < 2; i++ {
+		src, err := s.Get(context.TODO(), "example.com:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && src.ID() != e.Next {
+			t.Fatalf("Unexpected source: explain predicted %v, found %v", e.Next, src.ID())
+		}
+	}
+
+	for _, id := range []string{"s1", "s2"} {
+		if err := s.AppendPolicy(store.NewBlockPolicy("test", id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e = s.Explain(context.TODO(), "example.com:443")
+	if e.Next != "" || e.Error == "" {
+		t.Fatalf("No source should be available: %+v", e)
+	}
+}
+
+func TestExplain_breaker(t *testing.T) {
+	b := &core.Balancer{BreakerThreshold: 1, BreakerCooldown: time.Millisecond}
+	s := store.New(b)
+	s.Put(&mock{id: "s0"}, &mock{id: "s1"})
+
+	s.ReportDial("s0", context.DeadlineExceeded)
+	time.Sleep(time.Millisecond * 5)
+
+	// The trial request of the breaker is left to the real traffic.
+	for i := 0; i < 3; i++ {
+		e := s.Explain(context.TODO(), "example.com:443")
+		if e.Error != "" {
+			t.Fatalf("%d: Unexpected error: %v", i, e.Error)
+		}
+		if st := b.BreakerState("s0"); st != core.Open {
+			t.Fatalf("%d: Unexpected breaker state: wanted %v, found %v", i, core.Open, st)
+		}
+	}
+
+	if _, err := s.Get(context.TODO(), "example.com:443"); err != nil {
+		t.Fatal(err)
+	}
+	if st := b.BreakerState("s0"); st != core.HalfOpen {
+		t.Fatalf("Unexpected breaker state: wanted %v, found %v", core.HalfOpen, st)
+	}
+}
+
+func TestExplain_bindHistory(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(new(core.Balancer))
+	s.Put(&mock{id: "s0"}, &mock{id: "s1"})
+	events := 0
+	s.OnBindHistoryEvent = func(event string) {
+		events++
+	}
+	p, err := s.MakePolicy(store.PolicyRecord{Code: store.PolicyCodeStick, Issuer: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	s.SaveBindHistory(context.TODO(), "s1", "example.com")
+
+	e := s.Explain(context.TODO(), "example.com:443")
+	if e.BoundTo != "s1" || e.Next != "s1" {
+		t.Fatalf("Unexpected explanation: %+v", e)
+	}
+	e = s.Explain(context.TODO(), "example.org:443")
+	if e.BoundTo != "" {
+		t.Fatalf("Unexpected explanation: %+v", e)
+	}
+	if events != 0 {
+		t.Fatalf("Explain should not report bind history events, found %d", events)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import "fmt"
+
+// Modes in which ImportPolicies applies a document.
+const (
+	// ImportReplace replaces every policy of the store with the
+	// ones of the document.
+	ImportReplace = "replace"
+	// ImportMerge adds the policies of the document to the ones of
+	// the store, replacing those with the same identifier.
+	ImportMerge = "merge"
+)
+
+// ExportPolicies returns the records of the policies of the store, in the
+// order they are evaluated. Policies that cannot be persisted, such as the
+// generic ones, are left out.
+func (ss *SourceStore) ExportPolicies() PolicyDocument {
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+	return makePolicyDocument(ss.policies.val)
+}
+
+// ImportPolicies applies the policies of `doc`, which usually comes from
+// ExportPolicies, according to `mode`, which is either ImportReplace or
+// ImportMerge. Every record is validated, see PolicyRecord.Validate, and
+// expired policies are refused. The import is atomic: either every policy
+// is applied, or none is and an error is returned.
+func (ss *SourceStore) ImportPolicies(doc PolicyDocument, mode string) error {
+	if doc.Version != PolicyDocumentVersion {
+		return fmt.Errorf("source store: unsupported policies document version %d", doc.Version)
+	}
+	if mode != ImportReplace && mode != ImportMerge {
+		return fmt.Errorf("source store: unknown import mode %q, expected %s or %s", mode, ImportReplace, ImportMerge)
+	}
+
+	now := ss.Now()
+	add := make([]Policy, 0, len(doc.Policies))
+	imported := make(map[string]bool, len(doc.Policies))
+	for i, r := range doc.Policies {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("source store: policy #%d: %v", i, err)
+		}
+		if r.ExpiresAt != nil && !now.Before(*r.ExpiresAt) {
+			return fmt.Errorf("source store: policy #%d is already expired", i)
+		}
+		p, err := ss.MakePolicy(r)
+		if err != nil {
+			return fmt.Errorf("source store: policy #%d: %v", i, err)
+		}
+		if imported[p.ID()] {
+			return fmt.Errorf("source store: policy %v is present more than once", p.ID())
+		}
+		imported[p.ID()] = true
+		add = append(add, p)
+	}
+
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+
+	var del []string
+	for _, v := range ss.policies.val {
+		if mode == ImportReplace || imported[v.ID()] {
+			del = append(del, v.ID())
+		}
+	}
+	return ss.updatePolicies(del, add)
+}
@@ -0,0 +1,186 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func policyIDs(s *store.SourceStore) []string {
+	var ids []string
+	for _, p := range s.GetPoliciesSnapshot() {
+		ids = append(ids, p.ID())
+	}
+	return ids
+}
+
+func TestExportPolicies(t *testing.T) {
+	store.Resolver = resolver{}
+	src := store.New(&storage{})
+	bp := store.NewBlockPolicy("test", "wwan0")
+	bp.SetRank(5, store.EffectDeny)
+	rp := store.NewRoutePolicy("test", "eth1", store.Match{Network: "udp", Clients: []string{"192.168.1.50"}}, "*.valve.net")
+	if err := src.UpdatePolicies(nil, []store.Policy{
+		bp,
+		store.NewReservedPolicy("test", "eth0", "example.com"),
+		rp,
+		&store.GenPolicy{Name: "generic", AcceptFunc: func(id, address string) bool { return true }},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := src.ExportPolicies()
+	if doc.Version != store.PolicyDocumentVersion || len(doc.Policies) != 3 {
+		t.Fatalf("Unexpected document: %+v", doc)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded store.PolicyDocument
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Policies[0].SourceID != "wwan0" || decoded.Policies[0].Priority != 5 {
+		t.Fatalf("Type specific fields should be exported: %+v", decoded.Policies[0])
+	}
+
+	// Replace drops the policies that are not in the document.
+	dst := store.New(&storage{})
+	if err := dst.AppendPolicy(store.NewAvoidPolicy("test", "wwan0", "example.org")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.ImportPolicies(decoded, store.ImportReplace); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"block_wwan0", "reserve_eth0", rp.ID()}
+	if ids := policyIDs(dst); len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] || ids[2] != want[2] {
+		t.Fatalf("Unexpected policies after replace: %v", ids)
+	}
+
+	// Merge keeps them, and replaces the ones with the same identifier.
+	dst = store.New(&storage{})
+	if err := dst.UpdatePolicies(nil, []store.Policy{
+		store.NewAvoidPolicy("test", "wwan0", "example.org"),
+		store.NewBlockPolicy("test", "wwan0"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.ImportPolicies(decoded, store.ImportMerge); err != nil {
+		t.Fatal(err)
+	}
+	if ids := policyIDs(dst); len(ids) != 4 || ids[0] != "block_wwan0" {
+		t.Fatalf("Unexpected policies after merge: %v", ids)
+	}
+}
+
+func TestImportPolicies_atomic(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	if err := s.AppendPolicy(store.NewBlockPolicy("test", "wwan0")); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	tt := []struct {
+		doc  store.PolicyDocument
+		mode string
+	}{
+		{doc: store.PolicyDocument{Version: 2}, mode: store.ImportReplace},
+		{doc: store.PolicyDocument{Version: store.PolicyDocumentVersion}, mode: "append"},
+		{
+			// Unknown policy code.
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeBlock, SourceID: "eth0"},
+				{Code: 42},
+			}},
+			mode: store.ImportReplace,
+		},
+		{
+			// Duplicate policy.
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeBlock, SourceID: "eth0"},
+				{Code: store.PolicyCodeBlock, SourceID: "eth0"},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			// Reserve policy without hosts.
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeBlock, SourceID: "eth0"},
+				{Code: store.PolicyCodeReserve, SourceID: "eth1"},
+			}},
+			mode: store.ImportReplace,
+		},
+		{
+			// Missing source, invalid values and expired policies.
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeBlock},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeRoute, SourceID: "eth0", Hosts: []string{"steam*.com"}},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeRoute, SourceID: "eth0", Network: "sctp"},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeAvoid, SourceID: "eth0", Clients: []string{"192.168.1"}},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeQuota, SourceID: "eth0"},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeBlock, SourceID: "eth0", ExpiresAt: &expired},
+			}},
+			mode: store.ImportMerge,
+		},
+		{
+			// Conflicting reservations.
+			doc: store.PolicyDocument{Version: store.PolicyDocumentVersion, Policies: []store.PolicyRecord{
+				{Code: store.PolicyCodeReserve, SourceID: "eth0", Hosts: []string{"example.com"}},
+				{Code: store.PolicyCodeReserve, SourceID: "eth1", Hosts: []string{"example.com"}},
+			}},
+			mode: store.ImportReplace,
+		},
+	}
+	for i, v := range tt {
+		if err := s.ImportPolicies(v.doc, v.mode); err == nil {
+			t.Fatalf("%d: ImportPolicies should fail", i)
+		}
+		if ids := policyIDs(s); len(ids) != 1 || ids[0] != "block_wwan0" {
+			t.Fatalf("%d: Policies should not change on failure, found %v", i, ids)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"container/list"
+	"time"
+)
+
+// BindHistorySize is the maximum number of addresses remembered by the
+// bind history. The least recently used addresses are evicted first.
+var BindHistorySize = 4096
+
+// BindHistoryTTL is how long an address is remembered by the bind
+// history after it was last bound to a source.
+var BindHistoryTTL = time.Hour
+
+// Bind history events, reported through SourceStore.OnBindHistoryEvent.
+const (
+	BindHistoryHit      = "hit"
+	BindHistoryMiss     = "miss"
+	BindHistoryEviction = "eviction"
+)
+
+type bindEntry struct {
+	address string
+	id      string
+	expires time.Time
+}
+
+// bindCache is a size bounded LRU cache that associates addresses with
+// sources, with a per-entry time to live. It is not safe for concurrent
+// use.
+type bindCache struct {
+	size int
+	ttl  time.Duration
+	ll   *list.List // most recently used first.
+	idx  map[string]*list.Element
+}
+
+func newBindCache(size int, ttl time.Duration) *bindCache {
+	return &bindCache{
+		size: size,
+		ttl:  ttl,
+		ll:   list.New(),
+		idx:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the source bound to `address`. Entries expired at `now` are
+// removed, in which case evicted is true.
+func (c *bindCache) get(address string, now time.Time) (id string, ok, evicted bool) {
+	e, ok := c.idx[address]
+	if !ok {
+		return "", false, false
+	}
+	entry := e.Value.(*bindEntry)
+	if !now.Before(entry.expires) {
+		c.remove(e)
+		return "", false, true
+	}
+	c.ll.MoveToFront(e)
+	return entry.id, true, false
+}
+
+// peek returns the source bound to `address`, like get, but it neither
+// marks the entry as recently used nor removes it once expired.
+func (c *bindCache) peek(address string, now time.Time) (id string, ok bool) {
+	e, ok := c.idx[address]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*bindEntry)
+	if !now.Before(entry.expires) {
+		return "", false
+	}
+	return entry.id, true
+}
+
+// put binds `address` to `id`, and returns the number of entries evicted
+// to make room for it.
+func (c *bindCache) put(address, id string, now time.Time) (evicted int) {
+	if e, ok := c.idx[address]; ok {
+		entry := e.Value.(*bindEntry)
+		entry.id, entry.expires = id, now.Add(c.ttl)
+		c.ll.MoveToFront(e)
+		return 0
+	}
+
+	c.idx[address] = c.ll.PushFront(&bindEntry{
+		address: address,
+		id:      id,
+		expires: now.Add(c.ttl),
+	})
+	for c.size > 0 && c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+		evicted++
+	}
+	return evicted
+}
+
+// drop removes the entries bound to `id`.
+func (c *bindCache) drop(id string) {
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*bindEntry).id == id {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+func (c *bindCache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.idx, e.Value.(*bindEntry).address)
+}
+
+func (c *bindCache) len() int {
+	return c.ll.Len()
+}
+
+// bindHistoryEvent reports `n` bind history events of kind `event`.
+func (ss *SourceStore) bindHistoryEvent(event string, n int) {
+	f := ss.OnBindHistoryEvent
+	if f == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		f(event)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+func TestBindHistory(t *testing.T) {
+	defer func(size int, ttl time.Duration) {
+		store.BindHistorySize, store.BindHistoryTTL = size, ttl
+	}(store.BindHistorySize, store.BindHistoryTTL)
+	store.BindHistorySize = 2
+	store.BindHistoryTTL = time.Minute
+	store.Resolver = resolver{}
+
+	c := &clock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	events := make(map[string]int)
+	s := store.New(&storage{})
+	s.Clock = c.Now
+	s.OnBindHistoryEvent = func(event string) {
+		events[event]++
+	}
+	s.RecordBindHistory()
+
+	ctx := context.TODO()
+	s.SaveBindHistory(ctx, "s0", "a.example.com")
+	s.SaveBindHistory(ctx, "s1", "b.example.com")
+	if id, ok := s.QueryBindHistory("a.example.com"); !ok || id != "s0" {
+		t.Fatalf("Unexpected bind history entry: %v, %v", id, ok)
+	}
+
+	// b.example.com is now the least recently used entry.
+	s.SaveBindHistory(ctx, "s0", "c.example.com")
+	if _, ok := s.QueryBindHistory("b.example.com"); ok {
+		t.Fatalf("Least recently used entry should be evicted")
+	}
+	if _, ok := s.QueryBindHistory("c.example.com"); !ok {
+		t.Fatalf("Recent entry should be present")
+	}
+
+	// Entries expire after BindHistoryTTL.
+	c.now = c.now.Add(time.Minute)
+	if _, ok := s.QueryBindHistory("a.example.com"); ok {
+		t.Fatalf("Entry should be expired")
+	}
+
+	want := map[string]int{
+		store.BindHistoryHit:      2,
+		store.BindHistoryMiss:     2,
+		store.BindHistoryEviction: 2,
+	}
+	for k, v := range want {
+		if events[k] != v {
+			t.Fatalf("Unexpected %s events: wanted %d, found %d", k, v, events[k])
+		}
+	}
+}
+
+func TestBindHistory_get(t *testing.T) {
+	// Do not save the bind history in background.
+	defer func(n int) { store.MaxPendingBindHistory = n }(store.MaxPendingBindHistory)
+	store.MaxPendingBindHistory = 0
+	store.Resolver = resolver{}
+	events := make(map[string]int)
+	s := store.New(new(core.Balancer))
+	s.OnBindHistoryEvent = func(event string) {
+		events[event]++
+	}
+	s.Put(&mock{id: "s0"}, &mock{id: "s1"}, &mock{id: "s2"}, &mock{id: "s3"})
+	if err := s.AppendPolicy(store.NewStickyPolicy("test", s.QueryBindHistory)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each Get queries the bind history once, whatever
+	// the number of sources.
+	for i := 1; i <= 2; i++ {
+		if _, err := s.Get(context.TODO(), "a.example.com:443"); err != nil {
+			t.Fatal(err)
+		}
+		if n := events[store.BindHistoryHit] + events[store.BindHistoryMiss]; n != i {
+			t.Fatalf("%d: Unexpected bind history queries: wanted %d, found %d", i, i, n)
+		}
+	}
+}
+
+func TestBindHistory_del(t *testing.T) {
+	store.Resolver = resolver{}
+	b := new(core.Balancer)
+	s := store.New(b)
+	s0, s1 := &mock{id: "s0"}, &mock{id: "s1"}
+	s.Put(s0, s1)
+	s.RecordBindHistory()
+
+	ctx := context.TODO()
+	s.SaveBindHistory(ctx, "s0", "a.example.com")
+	s.SaveBindHistory(ctx, "s1", "b.example.com")
+
+	s.Del(s0)
+	if _, ok := s.QueryBindHistory("a.example.com"); ok {
+		t.Fatalf("Entries of removed sources should be dropped")
+	}
+	if _, ok := s.QueryBindHistory("b.example.com"); !ok {
+		t.Fatalf("Entries of other sources should be kept")
+	}
+}
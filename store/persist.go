@@ -0,0 +1,333 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"upspin.io/log"
+)
+
+// PolicyDocumentVersion is the version of the format used to save
+// policies into the state file, and to export them.
+const PolicyDocumentVersion = 1
+
+// PolicyRecord is the serializable representation of a policy, as it is
+// saved in the state file. It contains only the fields required to create
+// the policy again with its constructor.
+type PolicyRecord struct {
+	Code      int         `json:"code"`
+	Issuer    string      `json:"issuer"`
+	Reason    string      `json:"reason,omitempty"`
+	SourceID  string      `json:"source_id,omitempty"`
+	Hosts     []string    `json:"hosts,omitempty"`
+	Address   string      `json:"address,omitempty"`
+	Network   string      `json:"network,omitempty"`
+	Ports     []PortRange `json:"ports,omitempty"`
+	Clients   []string    `json:"clients,omitempty"`
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	Window    *Window     `json:"window,omitempty"`
+	Budget    int64       `json:"budget,omitempty"`
+	ResetDay  int         `json:"reset_day,omitempty"`
+	Priority  int         `json:"priority,omitempty"`
+	Effect    Effect      `json:"effect,omitempty"`
+}
+
+// Validate returns an error if the policy described by `r` is not valid,
+// applying the same checks of the API and of the configuration file: for
+// example a reserve policy requires some hosts, and every host must be a
+// valid pattern. It does not check whether the policy is expired.
+func (r PolicyRecord) Validate() error {
+	var kind string
+	switch r.Code {
+	case PolicyCodeBlock:
+		kind = "block"
+	case PolicyCodeReserve:
+		kind = "reserve"
+	case PolicyCodeStick:
+		kind = "sticky"
+	case PolicyCodeAvoid:
+		kind = "avoid"
+	case PolicyCodeRoute:
+		kind = "route"
+	case PolicyCodeQuota:
+		kind = "quota"
+	default:
+		return fmt.Errorf("unknown policy code %d", r.Code)
+	}
+
+	if r.Code != PolicyCodeStick && r.SourceID == "" {
+		return fmt.Errorf("%s policy requires a source", kind)
+	}
+	switch {
+	case r.Code == PolicyCodeReserve && len(r.Hosts) == 0:
+		return fmt.Errorf("reserve policy requires at least one host")
+	case r.Code == PolicyCodeAvoid && r.Address == "" && r.match().IsZero():
+		return fmt.Errorf("avoid policy requires an address, a network, some ports or some clients")
+	case r.Code == PolicyCodeRoute && len(r.Hosts) == 0 && r.match().IsZero():
+		return fmt.Errorf("route policy requires some hosts, a network, some ports or some clients")
+	case r.Code == PolicyCodeQuota && r.Budget <= 0:
+		return fmt.Errorf("budget must be positive")
+	case r.Code == PolicyCodeQuota && (r.ResetDay < 0 || r.ResetDay > 28):
+		return fmt.Errorf("reset_day must be between 1 and 28, or 0 for the first day of the month")
+	}
+
+	for _, v := range r.Hosts {
+		if err := ValidateHostPattern(v); err != nil {
+			return err
+		}
+	}
+	if r.Address != "" {
+		if err := ValidateHostPattern(r.Address); err != nil {
+			return err
+		}
+	}
+	if err := ValidateNetwork(r.Network); err != nil {
+		return err
+	}
+	for _, v := range r.Ports {
+		if _, err := ParsePortRange(v.String()); err != nil {
+			return err
+		}
+	}
+	for _, v := range r.Clients {
+		if err := ValidateClient(v); err != nil {
+			return err
+		}
+	}
+	effect, err := ParseEffect(string(r.Effect))
+	if err != nil {
+		return err
+	}
+	if effect == EffectAllow && r.Code != PolicyCodeBlock && r.Code != PolicyCodeAvoid {
+		return fmt.Errorf("%s policy does not support the allow effect", kind)
+	}
+	return nil
+}
+
+func (r PolicyRecord) match() Match {
+	return Match{Network: r.Network, Ports: r.Ports, Clients: r.Clients}
+}
+
+// PolicyDocument is the list of policies, in the format used by the state
+// file and by ExportPolicies.
+type PolicyDocument struct {
+	Version  int            `json:"version"`
+	Policies []PolicyRecord `json:"policies"`
+}
+
+func (p basePolicy) base() basePolicy {
+	return p
+}
+
+// MakePolicyRecord returns the record representing `p`. Returns false if
+// `p` cannot be saved, as it happens for policies that are not created
+// with one of the constructors of this package.
+func MakePolicyRecord(p Policy) (PolicyRecord, bool) {
+	var r PolicyRecord
+	switch v := p.(type) {
+	case *BlockPolicy:
+		r = PolicyRecord{SourceID: v.SourceID}
+	case *ReservedPolicy:
+		r = PolicyRecord{SourceID: v.SourceID, Hosts: v.Hosts}
+	case *AvoidPolicy:
+		r = PolicyRecord{SourceID: v.SourceID, Address: v.Address, Network: v.Match.Network, Ports: v.Match.Ports, Clients: v.Match.Clients}
+	case *RoutePolicy:
+		r = PolicyRecord{SourceID: v.SourceID, Hosts: v.Hosts, Network: v.Match.Network, Ports: v.Match.Ports, Clients: v.Match.Clients}
+	case *QuotaPolicy:
+		r = PolicyRecord{SourceID: v.SourceID, Hosts: v.Hosts, Budget: v.Budget, ResetDay: v.ResetDay}
+	case *StickyPolicy:
+	default:
+		return PolicyRecord{}, false
+	}
+
+	b := p.(interface{ base() basePolicy }).base()
+	r.Code, r.Issuer, r.Reason = b.Code, b.Issuer, b.Reason
+	r.ExpiresAt, r.Window = b.ExpiresAt, b.Window
+	r.Priority, r.Effect = b.Priority, b.Effect
+	return r, true
+}
+
+// MakePolicy creates the policy described by `r`. Sticky policies are bound
+// to the bind history of the store, and quota policies to its usage counters.
+func (ss *SourceStore) MakePolicy(r PolicyRecord) (Policy, error) {
+	var p interface {
+		Policy
+		TimeBound
+		Ranked
+	}
+	switch r.Code {
+	case PolicyCodeBlock:
+		bp := NewBlockPolicy(r.Issuer, r.SourceID)
+		bp.Reason = r.Reason
+		p = bp
+	case PolicyCodeReserve:
+		rp := NewReservedPolicy(r.Issuer, r.SourceID, r.Hosts...)
+		rp.Reason = r.Reason
+		p = rp
+	case PolicyCodeAvoid:
+		ap := NewPortAvoidPolicy(r.Issuer, r.SourceID, r.Address, r.match())
+		ap.Reason = r.Reason
+		p = ap
+	case PolicyCodeRoute:
+		rp := NewRoutePolicy(r.Issuer, r.SourceID, r.match(), r.Hosts...)
+		rp.Reason = r.Reason
+		p = rp
+	case PolicyCodeQuota:
+		qp := NewQuotaPolicy(r.Issuer, r.SourceID, r.Budget, r.ResetDay, ss.QueryUsage, r.Hosts...)
+		qp.Clock = ss.Now
+		qp.Reason = r.Reason
+		p = qp
+	case PolicyCodeStick:
+		sp := NewStickyPolicy(r.Issuer, ss.QueryBindHistory)
+		sp.PeekBindHistory = ss.PeekBindHistory
+		sp.Reason = r.Reason
+		p = sp
+	default:
+		return nil, fmt.Errorf("source store: unknown policy code %d", r.Code)
+	}
+	p.SetSchedule(r.ExpiresAt, r.Window)
+	p.SetRank(r.Priority, r.Effect)
+	return p, nil
+}
+
+// PersistPolicies makes the store save its list of policies into the file
+// at `path` each time it changes. The policies already saved in the file,
+// if any, are restored before returning, with the checks of ImportPolicies:
+// invalid or conflicting policies make the restore fail, while expired ones
+// are dropped.
+func (ss *SourceStore) PersistPolicies(path string) error {
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("source store: unable to read policies: %v", err)
+	}
+
+	val := make([]Policy, len(ss.policies.val))
+	copy(val, ss.policies.val)
+	if err == nil {
+		var state PolicyDocument
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("source store: unable to decode policies from %s: %v", path, err)
+		}
+		if state.Version != PolicyDocumentVersion {
+			return fmt.Errorf("source store: unsupported policies file version %d", state.Version)
+		}
+
+		now := ss.Now()
+	Loop:
+		for i, r := range state.Policies {
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("source store: policy #%d of %s: %v", i, path, err)
+			}
+			p, err := ss.MakePolicy(r)
+			if err != nil {
+				return fmt.Errorf("source store: policy #%d of %s: %v", i, path, err)
+			}
+			if r.ExpiresAt != nil && !now.Before(*r.ExpiresAt) {
+				log.Info.Printf("SourceStore: policy %s of %s expired at %v, dropping it", p.ID(), path, *r.ExpiresAt)
+				continue
+			}
+			for _, v := range val {
+				if v.ID() == p.ID() {
+					continue Loop
+				}
+			}
+			if err := validateRank(p); err != nil {
+				return err
+			}
+			if err := checkConflicts(val, p); err != nil {
+				return err
+			}
+			val = append(val, p)
+		}
+	}
+
+	ss.policies.path = path
+	if err := ss.setPolicies(val); err != nil {
+		ss.policies.path = ""
+		return err
+	}
+	return nil
+}
+
+// savePolicies writes `val` into the state file, if the store is persisting
+// its policies. The file is replaced atomically, so that a crash never leaves
+// it half written. Must be called with the policies lock held.
+func (ss *SourceStore) savePolicies(val []Policy) error {
+	if ss.policies.path == "" {
+		return nil
+	}
+
+	state := makePolicyDocument(val)
+	data, err := json.MarshalIndent(&state, "", "\t")
+	if err != nil {
+		return fmt.Errorf("source store: unable to encode policies: %v", err)
+	}
+	if err := writeFileAtomic(ss.policies.path, data); err != nil {
+		return fmt.Errorf("source store: unable to save policies: %v", err)
+	}
+	return nil
+}
+
+// makePolicyDocument returns the document that contains the records of the
+// policies in `val`, in the same order. Policies that cannot be persisted
+// are left out.
+func makePolicyDocument(val []Policy) PolicyDocument {
+	doc := PolicyDocument{
+		Version:  PolicyDocumentVersion,
+		Policies: make([]PolicyRecord, 0, len(val)),
+	}
+	for _, p := range val {
+		r, ok := MakePolicyRecord(p)
+		if !ok {
+			log.Debug.Printf("SourceStore: policy %s cannot be persisted", p.ID())
+			continue
+		}
+		doc.Policies = append(doc.Policies, r)
+	}
+	return doc
+}
+
+// writeFileAtomic writes `data` to a temporary file in the same directory
+// of `path`, and then renames it to `path`.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
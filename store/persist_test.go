@@ -0,0 +1,158 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func TestPersistPolicies(t *testing.T) {
+	store.Resolver = resolver{
+		host:  "some.host",
+		addrs: []string{"192.168.0.61"},
+	}
+
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policies.json")
+
+	s := store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+
+	block := store.NewBlockPolicy("test", "s0")
+	block.Reason = "flaky"
+	s.AppendPolicy(block)
+	s.AppendPolicy(store.NewReservedPolicy("test", "s1", "some.host:443"))
+	s.AppendPolicy(store.NewAvoidPolicy("test", "s2", "some.host"))
+	s.AppendPolicy(store.NewStickyPolicy("test", s.QueryBindHistory))
+	s.AppendPolicy(&store.GenPolicy{Name: "gen", AcceptFunc: func(id, address string) bool { return true }})
+	if err := s.DelPolicy("avoid_s2_for_some.host"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore the policies into a new store.
+	s = store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{"block_s0", "reserve_s1", "stick"}
+	pp := s.GetPoliciesSnapshot()
+	if len(pp) != len(ids) {
+		t.Fatalf("Unexpected number of policies restored: wanted %d, found %d", len(ids), len(pp))
+	}
+	for i, p := range pp {
+		if p.ID() != ids[i] {
+			t.Fatalf("%d: Unexpected policy: wanted %s, found %s", i, ids[i], p.ID())
+		}
+	}
+
+	bp := pp[0].(*store.BlockPolicy)
+	if bp.SourceID != "s0" || bp.Reason != "flaky" {
+		t.Fatalf("Unexpected block policy restored: %+v", bp)
+	}
+	rp := pp[1].(*store.ReservedPolicy)
+	if len(rp.Addrs) != 1 || rp.Addrs[0] != "192.168.0.61" {
+		t.Fatalf("Unexpected reserved policy addresses: %v", rp.Addrs)
+	}
+
+	// The restored sticky policy should be bound to the new store.
+	s.SaveBindHistory(context.Background(), "s3", "some.host")
+	if ok, _ := s.ShouldAccept("s4", "192.168.0.61"); ok {
+		t.Fatal("Restored sticky policy does not use the bind history of the store")
+	}
+}
+
+func TestPersistPolicies_invalid(t *testing.T) {
+	store.Resolver = resolver{}
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policies.json")
+
+	tt := []string{
+		`{"version": 1, "policies": [{"code": 42}]}`,
+		`{"version": 1, "policies": [{"code": 2, "issuer": "test", "source_id": "s0"}]}`,
+		`{"version": 1, "policies": [{"code": 4, "issuer": "test", "source_id": "s0", "address": "*example.com"}]}`,
+		`{"version": 1, "policies": [{"code": 5, "issuer": "test", "source_id": "s0"}]}`,
+		`{"version": 1, "policies": [
+			{"code": 2, "issuer": "test", "source_id": "s0", "hosts": ["example.com"]},
+			{"code": 2, "issuer": "test", "source_id": "s1", "hosts": ["example.com"]}
+		]}`,
+	}
+	for i, v := range tt {
+		if err := ioutil.WriteFile(path, []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s := store.New(&storage{})
+		if err := s.PersistPolicies(path); err == nil {
+			t.Fatalf("%d: PersistPolicies should fail", i)
+		}
+		if len(s.GetPoliciesSnapshot()) != 0 {
+			t.Fatalf("%d: A failed restore should not install any policy", i)
+		}
+		if err := s.AppendPolicy(store.NewBlockPolicy("test", "s2")); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != v {
+			t.Fatalf("%d: A failed restore should not enable persistence", i)
+		}
+	}
+}
+
+func TestPersistPolicies_expired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policies.json")
+
+	data := `{"version": 1, "policies": [
+		{"code": 1, "issuer": "test", "source_id": "s0", "expires_at": "2019-03-01T11:00:00Z"},
+		{"code": 1, "issuer": "test", "source_id": "s1", "expires_at": "2019-03-01T13:00:00Z"}
+	]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &clock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	s := store.New(&storage{})
+	s.Clock = c.Now
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	if ids := policyIDs(s); len(ids) != 1 || ids[0] != "block_s1" {
+		t.Fatalf("Expired policies should be dropped: %v", ids)
+	}
+}
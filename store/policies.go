@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -29,7 +30,9 @@ type HostResolver interface {
 	LookupAddr(ctx context.Context, addr string) (hosts []string, err error)
 }
 
-var Resolver HostResolver = &net.Resolver{}
+// Resolver is used by the policies and by the bind history to perform DNS
+// lookups. By default, the results of the system resolver are cached.
+var Resolver HostResolver = NewCachingResolver(&net.Resolver{})
 
 // Policy codes, different for each `Policy` created.
 const (
@@ -37,6 +40,8 @@ const (
 	PolicyCodeReserve
 	PolicyCodeStick
 	PolicyCodeAvoid
+	PolicyCodeRoute
+	PolicyCodeQuota
 )
 
 type basePolicy struct {
@@ -58,6 +63,20 @@ type basePolicy struct {
 	// Addrs is the list of address address that the
 	// policy takes into consideration.
 	Addrs []string `json:"addresses"`
+
+	// ExpiresAt, if set, is the time after which the policy
+	// is no longer in effect, and is removed from the store.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Window, if set, restricts the policy to be in effect
+	// only during a daily time window.
+	Window *Window `json:"window,omitempty"`
+
+	// Priority and Effect tell in which order the policy is
+	// evaluated and what happens to the connections it matches,
+	// see Ranked.
+	Priority int    `json:"priority"`
+	Effect   Effect `json:"effect,omitempty"`
 }
 
 func (p basePolicy) ID() string {
@@ -83,8 +102,8 @@ func (p *GenPolicy) ID() string {
 }
 
 // Accept implements Policy.
-func (p *GenPolicy) Accept(id, address string) bool {
-	return p.AcceptFunc(id, address)
+func (p *GenPolicy) Accept(id string, t *Target) bool {
+	return p.AcceptFunc(id, t.Host)
 }
 
 // BlockPolicy blocks `SourceID`.
@@ -107,23 +126,32 @@ func NewBlockPolicy(issuer, sourceID string) *BlockPolicy {
 }
 
 // Accept implements Policy.
-func (p *BlockPolicy) Accept(id, address string) bool {
+func (p *BlockPolicy) Accept(id string, t *Target) bool {
 	return id != p.SourceID
 }
 
 // ReservedPolicy is a Policy implementation. It is used to reserve a source
-// to be used only for connections to a defined list of addresses, and those
+// to be used only for connections to a defined list of hosts, and those
 // connections will not be assigned to any other source.
+// Hosts may be exact hostnames or IP addresses, CIDR ranges such as
+// "10.0.0.0/8" or wildcard domains such as "*.example.com".
 type ReservedPolicy struct {
 	basePolicy
 	SourceID string `json:"reserved_source_id"`
+	// Hosts is the list of hosts the policy was created with,
+	// before being resolved into addresses.
+	Hosts []string `json:"hosts"`
+
+	matchers []hostMatcher
 }
 
 func NewReservedPolicy(issuer, sourceID string, hosts ...string) *ReservedPolicy {
 	addrs := []string{}
+	matchers := make([]hostMatcher, 0, len(hosts))
 	for _, v := range hosts {
-		address := TrimPort(v)
-		addrs = append(addrs, LookupAddress(address)...)
+		m := newHostMatcher(v)
+		matchers = append(matchers, m)
+		addrs = append(addrs, m.Addrs()...)
 	}
 	return &ReservedPolicy{
 		basePolicy: basePolicy{
@@ -134,19 +162,14 @@ func NewReservedPolicy(issuer, sourceID string, hosts ...string) *ReservedPolicy
 			Addrs:  addrs,
 		},
 		SourceID: sourceID,
+		Hosts:    hosts,
+		matchers: matchers,
 	}
 }
 
 // Accept implements Policy.
-func (p *ReservedPolicy) Accept(id, address string) bool {
-	isIn := false
-	for _, v := range p.Addrs {
-		if address == v {
-			isIn = true
-			break
-		}
-	}
-	if isIn {
+func (p *ReservedPolicy) Accept(id string, t *Target) bool {
+	if matchAny(p.matchers, t) {
 		return id == p.SourceID
 	}
 
@@ -154,43 +177,104 @@ func (p *ReservedPolicy) Accept(id, address string) bool {
 }
 
 // AvoidPolicy is a Policy implementation. It is used to avoid giving
-// connection to `Address` to `SourceID`.
+// connection to `Address` to `SourceID`. Address accepts the same
+// patterns of the hosts of a ReservedPolicy. The connections avoided
+// may be further restricted by network, destination port and client.
 type AvoidPolicy struct {
 	basePolicy
 	SourceID string `json:"avoid_source_id"`
 	Address  string `json:"address"`
+	Match    Match  `json:"match"`
+
+	matcher *hostMatcher
 }
 
 func NewAvoidPolicy(issuer, sourceID, address string) *AvoidPolicy {
+	return NewPortAvoidPolicy(issuer, sourceID, address, Match{})
+}
+
+// NewPortAvoidPolicy is like NewAvoidPolicy, but only avoids the connections
+// matching `m`. Address may be empty, in which case connections to any host
+// matching `m` are avoided.
+func NewPortAvoidPolicy(issuer, sourceID, address string, m Match) *AvoidPolicy {
 	address = TrimPort(address)
-	return &AvoidPolicy{
+	target := joinNonEmpty("_", address, m.String())
+	p := &AvoidPolicy{
 		basePolicy: basePolicy{
-			Name:   fmt.Sprintf("avoid_%s_for_%s", sourceID, address),
+			Name:   fmt.Sprintf("avoid_%s_for_%s", sourceID, target),
 			Issuer: issuer,
 			Code:   PolicyCodeAvoid,
-			Desc:   fmt.Sprintf("source %v will not be used for connections to %s", sourceID, address),
-			Addrs:  LookupAddress(address),
+			Desc:   fmt.Sprintf("source %v will not be used for connections to %s", sourceID, target),
 		},
 		SourceID: sourceID,
 		Address:  address,
+		Match:    m,
+	}
+	if address != "" {
+		hm := newHostMatcher(address)
+		p.matcher = &hm
+		p.Addrs = hm.Addrs()
 	}
+	return p
 }
 
 // Accept implements Policy.
-func (p *AvoidPolicy) Accept(id, address string) bool {
-	isIn := false
-	for _, v := range p.Addrs {
-		if address == v {
-			isIn = true
-			break
-		}
-	}
-	if isIn {
+func (p *AvoidPolicy) Accept(id string, t *Target) bool {
+	if p.Match.match(t) && (p.matcher == nil || p.matcher.match(t)) {
 		return id != p.SourceID
 	}
 	return true
 }
 
+// RoutePolicy is a Policy implementation. It is used to make the connections
+// that match its rules use only `SourceID`, leaving the other connections
+// free to use any source, `SourceID` included. Connections are matched by
+// network, destination port and client and, if Hosts is not empty, by
+// destination host.
+type RoutePolicy struct {
+	basePolicy
+	SourceID string   `json:"route_source_id"`
+	Hosts    []string `json:"hosts,omitempty"`
+	Match    Match    `json:"match"`
+
+	matchers []hostMatcher
+}
+
+func NewRoutePolicy(issuer, sourceID string, m Match, hosts ...string) *RoutePolicy {
+	addrs := []string{}
+	matchers := make([]hostMatcher, 0, len(hosts))
+	for _, v := range hosts {
+		hm := newHostMatcher(v)
+		matchers = append(matchers, hm)
+		addrs = append(addrs, hm.Addrs()...)
+	}
+	target := joinNonEmpty("_", strings.Join(hosts, ","), m.String())
+	return &RoutePolicy{
+		basePolicy: basePolicy{
+			Name:   fmt.Sprintf("route_%s_for_%s", sourceID, target),
+			Issuer: issuer,
+			Code:   PolicyCodeRoute,
+			Desc:   fmt.Sprintf("connections to %s will only use source %v", target, sourceID),
+			Addrs:  addrs,
+		},
+		SourceID: sourceID,
+		Hosts:    hosts,
+		Match:    m,
+		matchers: matchers,
+	}
+}
+
+// Accept implements Policy.
+func (p *RoutePolicy) Accept(id string, t *Target) bool {
+	if !p.Match.match(t) {
+		return true
+	}
+	if len(p.matchers) > 0 && !matchAny(p.matchers, t) {
+		return true
+	}
+	return id == p.SourceID
+}
+
 // HistoryQueryFunc describes the function that is used to query the bind
 // history of an entity. It is called passing the connection address in question,
 // and it returns the source identifier that is associated to it and true,
@@ -202,6 +286,9 @@ type HistoryQueryFunc func(string) (string, bool)
 type StickyPolicy struct {
 	basePolicy
 	BindHistory HistoryQueryFunc `json:"-"`
+	// PeekBindHistory, if set, is used instead of BindHistory for the
+	// targets of dry runs, which should not affect the bind history.
+	PeekBindHistory HistoryQueryFunc `json:"-"`
 }
 
 func NewStickyPolicy(issuer string, f HistoryQueryFunc) *StickyPolicy {
@@ -217,14 +304,28 @@ func NewStickyPolicy(issuer string, f HistoryQueryFunc) *StickyPolicy {
 }
 
 // Accept implements Policy.
-func (p *StickyPolicy) Accept(id, address string) bool {
-	if hid, ok := p.BindHistory(address); ok {
+func (p *StickyPolicy) Accept(id string, t *Target) bool {
+	query := p.BindHistory
+	if t.dryRun && p.PeekBindHistory != nil {
+		query = p.PeekBindHistory
+	}
+	if hid, ok := t.boundSource(query); ok {
 		return id == hid
 	}
 
 	return true
 }
 
+func joinNonEmpty(sep string, elems ...string) string {
+	acc := make([]string, 0, len(elems))
+	for _, v := range elems {
+		if v != "" {
+			acc = append(acc, v)
+		}
+	}
+	return strings.Join(acc, sep)
+}
+
 // TrimPort removes port information from `address`.
 func TrimPort(address string) string {
 	host, _, err := net.SplitHostPort(address)
@@ -17,6 +17,7 @@ package store_test
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	"github.com/booster-proj/booster/store"
@@ -62,10 +63,10 @@ func TestBlockPolicy(t *testing.T) {
 	s1 := &mock{id: "bar"}
 	p := store.NewBlockPolicy("T", "foo")
 
-	if ok := p.Accept(s1.ID(), ""); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget("")); !ok {
 		t.Fatalf("Policy %s did not accept source %v", p.ID(), s1.ID())
 	}
-	if ok := p.Accept(s0.ID(), ""); ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget("")); ok {
 		t.Fatalf("Policy %s accepted source %v", p.ID(), s0.ID())
 	}
 }
@@ -79,25 +80,25 @@ func TestReservedPolicy(t *testing.T) {
 	t2 := "host2"
 
 	p := store.NewReservedPolicy("T", s0.ID(), t0)
-	if ok := p.Accept(s0.ID(), t0); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t0)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t0)
 	}
-	if ok := p.Accept(s0.ID(), t1); ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t1)); ok {
 		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s1.ID(), t1)
 	}
-	if ok := p.Accept(s1.ID(), t0); ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t0)); ok {
 		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s1.ID(), t0)
 	}
-	if ok := p.Accept(s1.ID(), t1); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t1)
 	}
 
 	// reserved policy with multiple addresses
 	p = store.NewReservedPolicy("T", s0.ID(), t0, t1)
-	if ok := p.Accept(s0.ID(), t0); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t0)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t0)
 	}
-	if ok := p.Accept(s0.ID(), t2); ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t2)); ok {
 		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s0.ID(), t2)
 	}
 }
@@ -110,16 +111,16 @@ func TestAvoidPolicy(t *testing.T) {
 	t1 := "host1"
 
 	p := store.NewAvoidPolicy("T", s0.ID(), t0)
-	if ok := p.Accept(s0.ID(), t0); ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t0)); ok {
 		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s0.ID(), t0)
 	}
-	if ok := p.Accept(s0.ID(), t1); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t1)
 	}
-	if ok := p.Accept(s1.ID(), t0); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t0)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t0)
 	}
-	if ok := p.Accept(s1.ID(), t1); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t1)
 	}
 }
@@ -137,30 +138,276 @@ func TestStickyPolicy(t *testing.T) {
 		return
 	})
 
-	if ok := p.Accept(s0.ID(), t0); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t0)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t0)
 	}
-	if ok := p.Accept(s1.ID(), t0); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t0)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t0)
 	}
-	if ok := p.Accept(s0.ID(), t1); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t1)
 	}
-	if ok := p.Accept(s1.ID(), t1); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t1)
 	}
 
 	history[t0] = s0.ID()
-	if ok := p.Accept(s0.ID(), t0); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t0)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t0)
 	}
-	if ok := p.Accept(s1.ID(), t0); ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t0)); ok {
 		t.Fatalf("Policy %s accepted source %v for address %s", p.ID(), s1.ID(), t0)
 	}
-	if ok := p.Accept(s0.ID(), t1); !ok {
+	if ok := p.Accept(s0.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s0.ID(), t1)
 	}
-	if ok := p.Accept(s1.ID(), t1); !ok {
+	if ok := p.Accept(s1.ID(), store.NewTarget(t1)); !ok {
 		t.Fatalf("Policy %s did not accept source %v for address %s", p.ID(), s1.ID(), t1)
 	}
 }
+
+func TestReservedPolicy_patterns(t *testing.T) {
+	store.Resolver = resolver{
+		addrs: []string{"10.1.2.3"},
+	}
+	s0 := &mock{id: "foo"}
+
+	p := store.NewReservedPolicy("T", s0.ID(), "10.0.0.0/8", "*.steamcontent.com", "192.168.1.1", "example.com")
+	tt := []struct {
+		target string
+		in     bool
+	}{
+		{target: "10.20.30.40:443", in: true},
+		{target: "11.0.0.1", in: false},
+		{target: "cache1.steamcontent.com:80", in: true},
+		{target: "CDN.SteamContent.com.", in: true},
+		{target: "steamcontent.com", in: true}, // resolves into 10.0.0.0/8
+		{target: "192.168.1.1", in: true},
+		{target: "192.168.1.2", in: false},
+		{target: "example.com", in: true},
+		{target: "unrelated.org", in: true}, // resolves into 10.0.0.0/8
+	}
+	for i, v := range tt {
+		if ok := p.Accept(s0.ID(), store.NewTarget(v.target)); ok != v.in {
+			t.Fatalf("%d: Unexpected Accept for %s: wanted %v, found %v", i, v.target, v.in, ok)
+		}
+	}
+
+	// Without a resolver able to resolve the targets, only host
+	// patterns may match hostnames.
+	store.Resolver = resolver{
+		addrs: []string{"172.16.0.1"},
+	}
+	p = store.NewReservedPolicy("T", s0.ID(), "10.0.0.0/8", "*.steamcontent.com")
+	if ok := p.Accept(s0.ID(), store.NewTarget("unrelated.org")); ok {
+		t.Fatal("Policy accepted a target outside of its patterns")
+	}
+	if ok := p.Accept(s0.ID(), store.NewTarget("a.steamcontent.com")); !ok {
+		t.Fatal("Policy did not accept a target matching its wildcard domain")
+	}
+}
+
+func TestReservedPolicy_addressChange(t *testing.T) {
+	defer func(r store.HostResolver) { store.Resolver = r }(store.Resolver)
+	store.Resolver = resolver{addrs: []string{"93.184.216.34"}}
+	p := store.NewReservedPolicy("T", "eth0", "cdn.example.com")
+
+	// The host now resolves to other addresses: targets are matched
+	// against the current ones, not the ones of the policy creation.
+	store.Resolver = resolver{addrs: []string{"151.101.1.1", "2a04:4e42::1"}}
+	tt := []struct {
+		host     string
+		reserved bool
+	}{
+		{"cdn.example.com", true},
+		{"151.101.1.1", true},
+		{"2a04:4e42:0::1", true},
+		{"93.184.216.34", false},
+	}
+	for i, v := range tt {
+		if ok := p.Accept("wwan0", store.NewTarget(net.JoinHostPort(v.host, "443"))); ok == v.reserved {
+			t.Fatalf("%d: Unexpected decision for wwan0 to %s: %v", i, v.host, ok)
+		}
+	}
+}
+
+func TestAvoidPolicy_patterns(t *testing.T) {
+	store.Resolver = resolver{
+		addrs: []string{"172.16.0.1"},
+	}
+	s0 := &mock{id: "foo"}
+	s1 := &mock{id: "bar"}
+
+	p := store.NewAvoidPolicy("T", s0.ID(), "*.netflix.com")
+	if ok := p.Accept(s0.ID(), store.NewTarget("www.netflix.com:443")); ok {
+		t.Fatalf("Policy %s accepted a target matching its wildcard domain", p.ID())
+	}
+	if ok := p.Accept(s1.ID(), store.NewTarget("www.netflix.com:443")); !ok {
+		t.Fatalf("Policy %s did not accept source %s", p.ID(), s1.ID())
+	}
+
+	p = store.NewAvoidPolicy("T", s0.ID(), "172.16.0.0/12")
+	if ok := p.Accept(s0.ID(), store.NewTarget("some.host")); ok {
+		t.Fatalf("Policy %s accepted a target resolving into its CIDR range", p.ID())
+	}
+}
+
+func TestValidateHostPattern(t *testing.T) {
+	tt := []struct {
+		in    string
+		valid bool
+	}{
+		{in: "example.com", valid: true},
+		{in: "example.com:443", valid: true},
+		{in: "10.0.0.0/8", valid: true},
+		{in: "*.example.com", valid: true},
+		{in: "", valid: false},
+		{in: "10.0.0.0/33", valid: false},
+		{in: "*", valid: false},
+		{in: "*.", valid: false},
+		{in: "ex*ample.com", valid: false},
+		{in: "*.*.example.com", valid: false},
+	}
+	for i, v := range tt {
+		if err := store.ValidateHostPattern(v.in); (err == nil) != v.valid {
+			t.Fatalf("%d: Unexpected validation result for %q: %v", i, v.in, err)
+		}
+	}
+}
+
+func TestRoutePolicy(t *testing.T) {
+	store.Resolver = resolver{}
+	s0 := &mock{id: "eth0"}
+	s1 := &mock{id: "wwan0"}
+
+	ports, _ := store.ParsePortRange("27000-27100")
+	p := store.NewRoutePolicy("T", s0.ID(), store.Match{Network: "udp", Ports: []store.PortRange{ports}})
+	if p.ID() != "route_eth0_for_udp:27000-27100" {
+		t.Fatalf("Unexpected policy identifier: %s", p.ID())
+	}
+
+	game := store.NewTarget("game.server:27015")
+	game.Network = "udp"
+	if ok := p.Accept(s0.ID(), game); !ok {
+		t.Fatalf("Policy %s did not accept source %v for game traffic", p.ID(), s0.ID())
+	}
+	if ok := p.Accept(s1.ID(), game); ok {
+		t.Fatalf("Policy %s accepted source %v for game traffic", p.ID(), s1.ID())
+	}
+
+	// Everything else may use any source.
+	web := store.NewTarget("game.server:27015")
+	for _, v := range []*store.Target{web, store.NewTarget("example.com:443")} {
+		if ok := p.Accept(s0.ID(), v); !ok {
+			t.Fatalf("Policy %s did not accept source %v for %v", p.ID(), s0.ID(), v.Host)
+		}
+		if ok := p.Accept(s1.ID(), v); !ok {
+			t.Fatalf("Policy %s did not accept source %v for %v", p.ID(), s1.ID(), v.Host)
+		}
+	}
+
+	// Routes may be restricted to some hosts.
+	p = store.NewRoutePolicy("T", s0.ID(), store.Match{Network: "udp"}, "*.valve.net")
+	other := store.NewTarget("other.net:27015")
+	other.Network = "udp"
+	if ok := p.Accept(s1.ID(), other); !ok {
+		t.Fatalf("Policy %s did not accept source %v for a host it does not route", p.ID(), s1.ID())
+	}
+	valve := store.NewTarget("cm.valve.net:27015")
+	valve.Network = "udp"
+	if ok := p.Accept(s1.ID(), valve); ok {
+		t.Fatalf("Policy %s accepted source %v for a host it routes", p.ID(), s1.ID())
+	}
+}
+
+func TestRoutePolicy_clients(t *testing.T) {
+	store.Resolver = resolver{}
+	p := store.NewRoutePolicy("T", "wwan0", store.Match{Clients: []string{"192.168.1.50", "10.0.0.0/24"}})
+	if p.ID() != "route_wwan0_for_from_192.168.1.50,10.0.0.0/24" {
+		t.Fatalf("Unexpected policy identifier: %s", p.ID())
+	}
+
+	tt := []struct {
+		client string
+		routed bool
+	}{
+		{"192.168.1.50", true},
+		{"10.0.0.7", true},
+		{"192.168.1.51", false},
+		{"", false},
+	}
+	for i, v := range tt {
+		target := store.NewTarget("example.com:443")
+		target.Client = net.ParseIP(v.client)
+		if ok := p.Accept("eth0", target); ok == v.routed {
+			t.Fatalf("%d: Unexpected decision for eth0 and client %q: %v", i, v.client, ok)
+		}
+		if ok := p.Accept("wwan0", target); !ok {
+			t.Fatalf("%d: Policy should always accept wwan0", i)
+		}
+	}
+
+	for i, v := range []string{"192.168.1", "10.0.0.0/33", "example.com"} {
+		if err := store.ValidateClient(v); err == nil {
+			t.Fatalf("%d: ValidateClient(%q) should fail", i, v)
+		}
+	}
+}
+
+func TestAvoidPolicy_ports(t *testing.T) {
+	store.Resolver = resolver{}
+	s0 := &mock{id: "wwan0"}
+	s1 := &mock{id: "eth0"}
+
+	p := store.NewPortAvoidPolicy("T", s0.ID(), "", store.Match{Network: "tcp", Ports: []store.PortRange{{From: 443, To: 443}}})
+	if p.ID() != "avoid_wwan0_for_tcp:443" {
+		t.Fatalf("Unexpected policy identifier: %s", p.ID())
+	}
+	if ok := p.Accept(s0.ID(), store.NewTarget("example.com:443")); ok {
+		t.Fatalf("Policy %s accepted source %v for port 443", p.ID(), s0.ID())
+	}
+	if ok := p.Accept(s1.ID(), store.NewTarget("example.com:443")); !ok {
+		t.Fatalf("Policy %s did not accept source %v for port 443", p.ID(), s1.ID())
+	}
+	if ok := p.Accept(s0.ID(), store.NewTarget("example.com:80")); !ok {
+		t.Fatalf("Policy %s did not accept source %v for port 80", p.ID(), s0.ID())
+	}
+	udp := store.NewTarget("example.com:443")
+	udp.Network = "udp"
+	if ok := p.Accept(s0.ID(), udp); !ok {
+		t.Fatalf("Policy %s did not accept source %v for udp traffic", p.ID(), s0.ID())
+	}
+
+	// Address and ports are combined.
+	p = store.NewPortAvoidPolicy("T", s0.ID(), "example.com", store.Match{Ports: []store.PortRange{{From: 443, To: 443}}})
+	if ok := p.Accept(s0.ID(), store.NewTarget("other.com:443")); !ok {
+		t.Fatalf("Policy %s did not accept source %v for another host", p.ID(), s0.ID())
+	}
+	if ok := p.Accept(s0.ID(), store.NewTarget("example.com:443")); ok {
+		t.Fatalf("Policy %s accepted source %v", p.ID(), s0.ID())
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tt := []struct {
+		in  string
+		out store.PortRange
+		err bool
+	}{
+		{in: "443", out: store.PortRange{From: 443, To: 443}},
+		{in: "27000-27100", out: store.PortRange{From: 27000, To: 27100}},
+		{in: "0", err: true},
+		{in: "100-10", err: true},
+		{in: "1-70000", err: true},
+		{in: "http", err: true},
+	}
+	for i, v := range tt {
+		r, err := store.ParsePortRange(v.in)
+		if (err != nil) != v.err {
+			t.Fatalf("%d: Unexpected error for %q: %v", i, v.in, err)
+		}
+		if err == nil && r != v.out {
+			t.Fatalf("%d: Unexpected range: wanted %v, found %v", i, v.out, r)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"upspin.io/log"
+)
+
+// usageStateVersion is the version of the format used to save
+// the usage counters into their state file.
+const usageStateVersion = 1
+
+// usageRetention is how long the daily usage counters are kept. It is
+// longer than any billing period.
+const usageRetention = time.Hour * 24 * 40
+
+// dayLayout is the format of the keys of the daily usage counters.
+const dayLayout = "2006-01-02"
+
+// UsageQueryFunc describes the function that is used to query the amount
+// of data transferred by a source. It is called passing the source identifier
+// and the time from which the data should be counted, and it returns the
+// number of bytes sent and received.
+type UsageQueryFunc func(id string, since time.Time) int64
+
+// QuotaStatus describes the state of the quota of a source in the current
+// billing period.
+type QuotaStatus struct {
+	SourceID  string    `json:"source_id"`
+	Budget    int64     `json:"budget"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// Exhausted reports whether the budget is used up.
+func (s QuotaStatus) Exhausted() bool {
+	return s.Remaining == 0
+}
+
+// QuotaPolicy is a Policy implementation. It is used to limit the amount of
+// data that a metered source transfers in each billing period, which starts
+// every month on ResetDay. Once Budget bytes are used up, the source is no
+// longer used until the period ends or, if Hosts is not empty, it is used
+// only for connections to Hosts. Hosts accepts the same patterns of the hosts
+// of a ReservedPolicy.
+type QuotaPolicy struct {
+	basePolicy
+	SourceID string   `json:"quota_source_id"`
+	Budget   int64    `json:"budget"`
+	ResetDay int      `json:"reset_day"`
+	Hosts    []string `json:"hosts,omitempty"`
+
+	// Usage is used to know how much data the source transferred.
+	Usage UsageQueryFunc `json:"-"`
+	// Clock, if set, is used instead of time.Now to tell
+	// the current billing period.
+	Clock func() time.Time `json:"-"`
+
+	matchers []hostMatcher
+}
+
+// NewQuotaPolicy creates a policy that allows `sourceID` to transfer `budget`
+// bytes every month, starting on `resetDay`, which should be between 1 and 28.
+// Values out of that range are clamped.
+func NewQuotaPolicy(issuer, sourceID string, budget int64, resetDay int, f UsageQueryFunc, hosts ...string) *QuotaPolicy {
+	if resetDay < 1 {
+		resetDay = 1
+	}
+	if resetDay > 28 {
+		resetDay = 28
+	}
+	addrs := []string{}
+	matchers := make([]hostMatcher, 0, len(hosts))
+	for _, v := range hosts {
+		m := newHostMatcher(v)
+		matchers = append(matchers, m)
+		addrs = append(addrs, m.Addrs()...)
+	}
+	desc := fmt.Sprintf("source %v will no longer be used once %d bytes are transferred in a month", sourceID, budget)
+	if len(hosts) > 0 {
+		desc = fmt.Sprintf("source %v will only be used for connections to %v once %d bytes are transferred in a month", sourceID, addrs, budget)
+	}
+	return &QuotaPolicy{
+		basePolicy: basePolicy{
+			Name:   "quota_" + sourceID,
+			Issuer: issuer,
+			Code:   PolicyCodeQuota,
+			Desc:   desc,
+			Addrs:  addrs,
+		},
+		SourceID: sourceID,
+		Budget:   budget,
+		ResetDay: resetDay,
+		Hosts:    hosts,
+		Usage:    f,
+		matchers: matchers,
+	}
+}
+
+// Accept implements Policy.
+func (p *QuotaPolicy) Accept(id string, t *Target) bool {
+	if id != p.SourceID || !p.Status().Exhausted() {
+		return true
+	}
+	return matchAny(p.matchers, t)
+}
+
+// Status returns the state of the quota in the current billing period.
+func (p *QuotaPolicy) Status() QuotaStatus {
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock()
+	}
+	start, end := BillingPeriod(now, p.ResetDay)
+
+	s := QuotaStatus{
+		SourceID: p.SourceID,
+		Budget:   p.Budget,
+		ResetsAt: end,
+	}
+	if p.Usage != nil {
+		s.Used = p.Usage(p.SourceID, start)
+	}
+	if s.Remaining = p.Budget - s.Used; s.Remaining < 0 {
+		s.Remaining = 0
+	}
+	return s
+}
+
+// BillingPeriod returns the start and the end of the monthly billing period
+// that contains `t`, given the day of the month in which periods start.
+func BillingPeriod(t time.Time, resetDay int) (start, end time.Time) {
+	y, m, d := t.Date()
+	if d < resetDay {
+		m--
+	}
+	start = time.Date(y, m, resetDay, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+type usageState struct {
+	Version int `json:"version"`
+	// Sources maps each source to the bytes it transferred
+	// each day.
+	Sources map[string]map[string]int64 `json:"sources"`
+}
+
+// AddUsage records that source `id` transferred `n` bytes.
+func (ss *SourceStore) AddUsage(id string, n int) {
+	day := ss.Now().Format(dayLayout)
+
+	ss.usage.Lock()
+	defer ss.usage.Unlock()
+
+	if ss.usage.val == nil {
+		ss.usage.val = make(map[string]map[string]int64)
+	}
+	days, ok := ss.usage.val[id]
+	if !ok {
+		days = make(map[string]int64)
+		ss.usage.val[id] = days
+	}
+	days[day] += int64(n)
+	ss.usage.dirty = true
+}
+
+// QueryUsage returns the number of bytes transferred by source `id` from the
+// day of `since`. It is an implementation of UsageQueryFunc.
+func (ss *SourceStore) QueryUsage(id string, since time.Time) int64 {
+	from := since.Format(dayLayout)
+
+	ss.usage.Lock()
+	defer ss.usage.Unlock()
+
+	var n int64
+	for day, v := range ss.usage.val[id] {
+		if day >= from {
+			n += v
+		}
+	}
+	return n
+}
+
+// Quotas returns the status of the quota of each source that has one.
+func (ss *SourceStore) Quotas() []QuotaStatus {
+	var acc []QuotaStatus
+	for _, p := range ss.GetPoliciesSnapshot() {
+		if qp, ok := p.(*QuotaPolicy); ok {
+			acc = append(acc, qp.Status())
+		}
+	}
+	sort.Slice(acc, func(i, j int) bool { return acc[i].SourceID < acc[j].SourceID })
+	return acc
+}
+
+// PersistUsage makes the store save its usage counters into the file at
+// `path` each time SaveUsage is called. The counters already saved in the
+// file, if any, are restored before returning.
+func (ss *SourceStore) PersistUsage(path string) error {
+	ss.usage.Lock()
+	defer ss.usage.Unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("source store: unable to read usage: %v", err)
+	}
+	if err == nil {
+		var state usageState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("source store: unable to decode usage from %s: %v", path, err)
+		}
+		if state.Version != usageStateVersion {
+			return fmt.Errorf("source store: unsupported usage file version %d", state.Version)
+		}
+		if ss.usage.val == nil {
+			ss.usage.val = make(map[string]map[string]int64)
+		}
+		for id, days := range state.Sources {
+			if ss.usage.val[id] == nil {
+				ss.usage.val[id] = make(map[string]int64)
+			}
+			for day, n := range days {
+				ss.usage.val[id][day] += n
+			}
+		}
+	}
+	ss.usage.path = path
+	return nil
+}
+
+// SaveUsage writes the usage counters into the state file, if the store
+// is persisting them and they changed since the last time they were saved.
+// Counters older than any billing period are dropped.
+func (ss *SourceStore) SaveUsage() error {
+	oldest := ss.Now().Add(-usageRetention).Format(dayLayout)
+
+	ss.usage.Lock()
+	defer ss.usage.Unlock()
+
+	if ss.usage.path == "" || !ss.usage.dirty {
+		return nil
+	}
+	for id, days := range ss.usage.val {
+		for day := range days {
+			if day < oldest {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(ss.usage.val, id)
+		}
+	}
+
+	state := usageState{
+		Version: usageStateVersion,
+		Sources: ss.usage.val,
+	}
+	data, err := json.MarshalIndent(&state, "", "\t")
+	if err != nil {
+		return fmt.Errorf("source store: unable to encode usage: %v", err)
+	}
+	if err := writeFileAtomic(ss.usage.path, data); err != nil {
+		return fmt.Errorf("source store: unable to save usage: %v", err)
+	}
+	ss.usage.dirty = false
+	return nil
+}
+
+// reportQuotas calls OnQuotaUpdate with the status of each quota, and logs
+// the quotas that were exhausted or renewed since the last call.
+func (ss *SourceStore) reportQuotas() {
+	quotas := ss.Quotas()
+
+	ss.usage.Lock()
+	if ss.usage.exhausted == nil {
+		ss.usage.exhausted = make(map[string]bool)
+	}
+	for _, s := range quotas {
+		if s.Exhausted() != ss.usage.exhausted[s.SourceID] {
+			if s.Exhausted() {
+				log.Info.Printf("SourceStore: quota of source %s exhausted, resets at %v", s.SourceID, s.ResetsAt)
+			} else {
+				log.Info.Printf("SourceStore: quota of source %s available", s.SourceID)
+			}
+		}
+		ss.usage.exhausted[s.SourceID] = s.Exhausted()
+	}
+	ss.usage.Unlock()
+
+	if f := ss.OnQuotaUpdate; f != nil {
+		for _, s := range quotas {
+			f(s)
+		}
+	}
+}
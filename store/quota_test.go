@@ -0,0 +1,184 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func TestBillingPeriod(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	tt := []struct {
+		t          time.Time
+		resetDay   int
+		start, end time.Time
+	}{
+		{t: date(2019, 3, 15), resetDay: 1, start: date(2019, 3, 1), end: date(2019, 4, 1)},
+		{t: date(2019, 3, 15), resetDay: 15, start: date(2019, 3, 15), end: date(2019, 4, 15)},
+		{t: date(2019, 3, 14), resetDay: 15, start: date(2019, 2, 15), end: date(2019, 3, 15)},
+		{t: date(2019, 1, 3), resetDay: 10, start: date(2018, 12, 10), end: date(2019, 1, 10)},
+	}
+	for i, v := range tt {
+		start, end := store.BillingPeriod(v.t, v.resetDay)
+		if !start.Equal(v.start) || !end.Equal(v.end) {
+			t.Fatalf("%d: Unexpected period: wanted %v-%v, found %v-%v", i, v.start, v.end, start, end)
+		}
+	}
+}
+
+func TestQuotaPolicy(t *testing.T) {
+	store.Resolver = resolver{}
+	c := &clock{now: time.Date(2019, 3, 20, 12, 0, 0, 0, time.UTC)}
+	s := store.New(&storage{})
+	s.Clock = c.Now
+
+	p := store.NewQuotaPolicy("test", "s0", 100, 15, s.QueryUsage)
+	p.Clock = c.Now
+	t0 := store.NewTarget("example.com:443")
+
+	// Usage of the previous billing period does not count.
+	c.now = time.Date(2019, 3, 14, 12, 0, 0, 0, time.UTC)
+	s.AddUsage("s0", 500)
+	c.now = time.Date(2019, 3, 20, 12, 0, 0, 0, time.UTC)
+	s.AddUsage("s0", 60)
+	s.AddUsage("s1", 500)
+
+	if st := p.Status(); st.Used != 60 || st.Remaining != 40 {
+		t.Fatalf("Unexpected status: %+v", st)
+	}
+	if !p.Accept("s0", t0) {
+		t.Fatalf("Source s0 should be accepted with quota available")
+	}
+
+	s.AddUsage("s0", 40)
+	if st := p.Status(); !st.Exhausted() {
+		t.Fatalf("Quota should be exhausted: %+v", st)
+	}
+	if p.Accept("s0", t0) {
+		t.Fatalf("Source s0 should not be accepted with quota exhausted")
+	}
+	if !p.Accept("s1", t0) {
+		t.Fatalf("Source s1 should not be affected by the quota of s0")
+	}
+
+	// Once exhausted, hosts are still allowed.
+	p = store.NewQuotaPolicy("test", "s0", 100, 15, s.QueryUsage, "*.example.com")
+	p.Clock = c.Now
+	if !p.Accept("s0", store.NewTarget("api.example.com:443")) {
+		t.Fatalf("Source s0 should be accepted for reserved hosts")
+	}
+	if p.Accept("s0", store.NewTarget("example.org:443")) {
+		t.Fatalf("Source s0 should not be accepted for other hosts")
+	}
+
+	// The quota is renewed with the next period.
+	c.now = time.Date(2019, 4, 15, 0, 0, 0, 0, time.UTC)
+	if !p.Accept("s0", t0) {
+		t.Fatalf("Source s0 should be accepted in the next period")
+	}
+}
+
+func TestPersistUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "usage.json")
+
+	c := &clock{now: time.Date(2019, 3, 20, 12, 0, 0, 0, time.UTC)}
+	s := store.New(&storage{})
+	s.Clock = c.Now
+	if err := s.PersistUsage(path); err != nil {
+		t.Fatal(err)
+	}
+	s.AddUsage("s0", 10)
+	c.now = c.now.AddDate(0, 0, 1)
+	s.AddUsage("s0", 20)
+	if err := s.SaveUsage(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = store.New(&storage{})
+	s.Clock = c.Now
+	if err := s.PersistUsage(path); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	if n := s.QueryUsage("s0", since); n != 30 {
+		t.Fatalf("Unexpected usage restored: wanted 30, found %d", n)
+	}
+	if n := s.QueryUsage("s0", since.AddDate(0, 0, 20)); n != 20 {
+		t.Fatalf("Unexpected usage restored: wanted 20, found %d", n)
+	}
+
+	// Counters older than any billing period are dropped.
+	c.now = c.now.AddDate(0, 3, 0)
+	s.AddUsage("s1", 1)
+	if err := s.SaveUsage(); err != nil {
+		t.Fatal(err)
+	}
+	s = store.New(&storage{})
+	if err := s.PersistUsage(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.QueryUsage("s0", since); n != 0 {
+		t.Fatalf("Old usage should be dropped, found %d", n)
+	}
+}
+
+func TestPersistPolicies_quota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policies.json")
+
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendPolicy(store.NewQuotaPolicy("test", "s0", 1<<30, 5, s.QueryUsage, "example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	s = store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	s.AddUsage("s0", 1<<29)
+	qq := s.Quotas()
+	if len(qq) != 1 {
+		t.Fatalf("Unexpected quotas restored: %v", qq)
+	}
+	if q := qq[0]; q.SourceID != "s0" || q.Budget != 1<<30 || q.Remaining != 1<<29 {
+		t.Fatalf("Unexpected quota restored: %+v", q)
+	}
+	qp := s.GetPoliciesSnapshot()[0].(*store.QuotaPolicy)
+	if qp.ResetDay != 5 || len(qp.Hosts) != 1 {
+		t.Fatalf("Unexpected policy restored: %+v", qp)
+	}
+}
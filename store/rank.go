@@ -0,0 +1,303 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Effect tells what happens to the connections matched by a policy. A
+// policy matches the connections that its Accept method rejects.
+type Effect string
+
+const (
+	// EffectDeny prevents the matched connections from using the
+	// source in question. It is the effect of policies that do not
+	// specify one.
+	EffectDeny Effect = "deny"
+	// EffectAllow makes the matched connections use the source
+	// in question, regardless of the policies with lower priority.
+	EffectAllow Effect = "allow"
+)
+
+// ParseEffect parses "allow" or "deny". The empty string is parsed as
+// EffectDeny.
+func ParseEffect(s string) (Effect, error) {
+	switch e := Effect(s); e {
+	case "", EffectDeny:
+		return EffectDeny, nil
+	case EffectAllow:
+		return e, nil
+	default:
+		return "", fmt.Errorf("invalid effect %q, expected allow or deny", s)
+	}
+}
+
+// Ranked is an optional interface implemented by policies that carry a
+// priority and an effect. Every policy of this package implements it.
+//
+// The store evaluates the policies from the highest priority to the lowest,
+// and policies with the same priority in the order they were added. The first
+// policy that matches a connection decides, according to its effect, whether
+// the source is accepted or not.
+type Ranked interface {
+	Rank() (priority int, effect Effect)
+	SetRank(priority int, effect Effect)
+}
+
+// Rank implements Ranked.
+func (p basePolicy) Rank() (int, Effect) {
+	if p.Effect == "" {
+		return p.Priority, EffectDeny
+	}
+	return p.Priority, p.Effect
+}
+
+// SetRank implements Ranked.
+func (p *basePolicy) SetRank(priority int, effect Effect) {
+	p.Priority = priority
+	p.Effect = effect
+}
+
+// rankOf returns the priority and the effect of `p`. Policies that do not
+// implement Ranked have priority 0 and deny.
+func rankOf(p Policy) (int, Effect) {
+	if r, ok := p.(Ranked); ok {
+		return r.Rank()
+	}
+	return 0, EffectDeny
+}
+
+// sortPolicies sorts `val` from the highest priority to the lowest,
+// keeping the order of the policies with the same priority.
+func sortPolicies(val []Policy) {
+	sort.SliceStable(val, func(i, j int) bool {
+		pi, _ := rankOf(val[i])
+		pj, _ := rankOf(val[j])
+		return pi > pj
+	})
+}
+
+// validateRank returns an error if `p` has an effect it does not support:
+// only block and avoid policies, which match a single source, may allow
+// connections.
+func validateRank(p Policy) error {
+	_, effect := rankOf(p)
+	switch effect {
+	case EffectDeny:
+		return nil
+	case EffectAllow:
+		switch p.(type) {
+		case *BlockPolicy, *AvoidPolicy:
+			return nil
+		}
+		return fmt.Errorf("source store: policy %v does not support the %s effect", p.ID(), effect)
+	default:
+		return fmt.Errorf("source store: policy %v has invalid effect %q", p.ID(), effect)
+	}
+}
+
+// claim describes the connections that a policy reserves to a single
+// source.
+type claim struct {
+	source string
+	// hosts matched by the claim, or empty to match any host.
+	hosts []hostMatcher
+	match Match
+}
+
+type claimer interface {
+	claim() claim
+}
+
+func (p *ReservedPolicy) claim() claim {
+	return claim{source: p.SourceID, hosts: p.matchers}
+}
+
+func (p *RoutePolicy) claim() claim {
+	return claim{source: p.SourceID, hosts: p.matchers, match: p.Match}
+}
+
+// conflicts reports whether `c` and `o` reserve some connection to
+// different sources, in which case no source could be used for it.
+func (c claim) conflicts(o claim) bool {
+	if c.source == o.source || !c.match.overlaps(o.match) {
+		return false
+	}
+	if len(c.hosts) == 0 || len(o.hosts) == 0 {
+		return true
+	}
+	for _, a := range c.hosts {
+		for _, b := range o.hosts {
+			if a.overlaps(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkConflicts returns an error if `p` conflicts with one of the
+// policies in `val`.
+func checkConflicts(val []Policy, p Policy) error {
+	c, ok := p.(claimer)
+	if !ok {
+		return nil
+	}
+	for _, v := range val {
+		if o, ok := v.(claimer); ok && c.claim().conflicts(o.claim()) {
+			return fmt.Errorf("source store: policy %v conflicts with %v, which reserves the same connections to another source", p.ID(), v.ID())
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether some connection may be matched by both
+// `m` and `o`.
+func (m Match) overlaps(o Match) bool {
+	if m.Network != "" && o.Network != "" && m.Network != o.Network {
+		return false
+	}
+	if !m.overlapsClients(o) {
+		return false
+	}
+	if len(m.Ports) == 0 || len(o.Ports) == 0 {
+		return true
+	}
+	for _, a := range m.Ports {
+		for _, b := range o.Ports {
+			if a.From <= b.To && b.From <= a.To {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m Match) overlapsClients(o Match) bool {
+	if len(m.Clients) == 0 || len(o.Clients) == 0 {
+		return true
+	}
+	for _, a := range m.Clients {
+		na, err := parseClient(a)
+		if err != nil {
+			continue
+		}
+		for _, b := range o.Clients {
+			nb, err := parseClient(b)
+			if err != nil {
+				continue
+			}
+			if na.Contains(nb.IP) || nb.Contains(na.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// overlaps reports whether some target may be matched by both `m`
+// and `o`. A wildcard domain never overlaps with a CIDR range, as it
+// is not possible to know which addresses its domains resolve to.
+func (m hostMatcher) overlaps(o hostMatcher) bool {
+	switch {
+	case m.ipnet != nil && o.ipnet != nil:
+		return m.ipnet.Contains(o.ipnet.IP) || o.ipnet.Contains(m.ipnet.IP)
+	case m.ipnet != nil:
+		return o.overlapsNet(m.ipnet)
+	case o.ipnet != nil:
+		return m.overlapsNet(o.ipnet)
+	case m.suffix != "" && o.suffix != "":
+		return strings.HasSuffix(m.suffix, o.suffix) || strings.HasSuffix(o.suffix, m.suffix)
+	case m.suffix != "":
+		return strings.HasSuffix(o.host, m.suffix)
+	case o.suffix != "":
+		return strings.HasSuffix(m.host, o.suffix)
+	}
+
+	if m.host == o.host {
+		return true
+	}
+	for _, a := range m.addrs {
+		for _, b := range o.addrs {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// overlapsNet reports whether the addresses of the exact host matched
+// by `m` belong to `n`.
+func (m hostMatcher) overlapsNet(n *net.IPNet) bool {
+	for _, v := range m.addrs {
+		if ip := net.ParseIP(v); ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPriorities changes the priority of the policies identified by the keys
+// of `priorities`, which reorders them, as a single operation: either every
+// policy is changed, or none is and an error is returned. The policies are
+// replaced with changed copies, as the ones in use may be read concurrently.
+func (ss *SourceStore) SetPriorities(priorities map[string]int) error {
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+
+	val := make([]Policy, len(ss.policies.val))
+	copy(val, ss.policies.val)
+	var changed []Policy
+	for i, p := range val {
+		priority, ok := priorities[p.ID()]
+		if !ok {
+			continue
+		}
+		r, ok := MakePolicyRecord(p)
+		if !ok {
+			return fmt.Errorf("source store: policy %s does not support priorities", p.ID())
+		}
+		r.Priority = priority
+		np, err := ss.MakePolicy(r)
+		if err != nil {
+			return err
+		}
+		val[i] = np
+		changed = append(changed, np)
+	}
+	if len(changed) != len(priorities) {
+		for id := range priorities {
+			found := false
+			for _, p := range changed {
+				found = found || p.ID() == id
+			}
+			if !found {
+				return fmt.Errorf("source store: no %s policy found", id)
+			}
+		}
+	}
+
+	if err := ss.setPolicies(val); err != nil {
+		return err
+	}
+	ss.recordAudit(AuditUpdate, changed...)
+	return nil
+}
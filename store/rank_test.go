@@ -0,0 +1,202 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/booster-proj/booster/store"
+)
+
+func TestShouldAccept_priority(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+
+	// Block wwan0, except for example.com.
+	if err := s.AppendPolicy(store.NewBlockPolicy("test", "wwan0")); err != nil {
+		t.Fatal(err)
+	}
+	allow := store.NewAvoidPolicy("test", "wwan0", "example.com")
+	allow.SetRank(10, store.EffectAllow)
+	if err := s.AppendPolicy(allow); err != nil {
+		t.Fatal(err)
+	}
+
+	pp := s.GetPoliciesSnapshot()
+	if pp[0].ID() != allow.ID() {
+		t.Fatalf("Policies should be sorted by priority: %v", pp)
+	}
+
+	tt := []struct {
+		id, address string
+		accept      bool
+		policy      string
+	}{
+		{"wwan0", "example.com:443", true, allow.ID()},
+		{"wwan0", "example.org:443", false, "block_wwan0"},
+		{"eth0", "example.com:443", true, ""},
+	}
+	for i, v := range tt {
+		ok, p := s.ShouldAccept(v.id, v.address)
+		if ok != v.accept {
+			t.Fatalf("%d: Unexpected decision for %s to %s: wanted %v, found %v", i, v.id, v.address, v.accept, ok)
+		}
+		var id string
+		if p != nil {
+			id = p.ID()
+		}
+		if id != v.policy {
+			t.Fatalf("%d: Unexpected deciding policy: wanted %q, found %q", i, v.policy, id)
+		}
+	}
+
+	// With a lower priority the allow rule is shadowed by the block.
+	if err := s.SetPriorities(map[string]int{allow.ID(): -1}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.ShouldAccept("wwan0", "example.com:443"); ok {
+		t.Fatalf("wwan0 should be blocked once the allow rule has lower priority")
+	}
+	if err := s.SetPriorities(map[string]int{allow.ID(): 1, "missing": 2}); err == nil {
+		t.Fatalf("SetPriorities should fail with unknown policies")
+	}
+	for _, v := range s.GetPoliciesSnapshot() {
+		if v.ID() != allow.ID() {
+			continue
+		}
+		if p, _ := v.(store.Ranked).Rank(); p != -1 {
+			t.Fatalf("Failed SetPriorities should not change priorities, found %d", p)
+		}
+	}
+	// Policies in use are replaced, not changed.
+	if p, _ := allow.Rank(); p != 10 {
+		t.Fatalf("SetPriorities should not change the policies in use, found %d", p)
+	}
+}
+
+func TestAppendPolicy_effect(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+
+	p := store.NewReservedPolicy("test", "eth0", "example.com")
+	p.SetRank(0, store.EffectAllow)
+	if err := s.AppendPolicy(p); err == nil {
+		t.Fatalf("Reserved policies should not support the allow effect")
+	}
+	b := store.NewBlockPolicy("test", "eth0")
+	b.SetRank(0, store.Effect("maybe"))
+	if err := s.AppendPolicy(b); err == nil {
+		t.Fatalf("Invalid effects should be rejected")
+	}
+}
+
+func TestAppendPolicy_conflicts(t *testing.T) {
+	store.Resolver = resolver{addrs: []string{"93.184.216.34"}}
+	tt := []struct {
+		a, b     store.Policy
+		conflict bool
+	}{
+		{
+			a:        store.NewReservedPolicy("test", "eth0", "example.com"),
+			b:        store.NewReservedPolicy("test", "wwan0", "example.com"),
+			conflict: true,
+		},
+		{
+			a:        store.NewReservedPolicy("test", "eth0", "example.com"),
+			b:        store.NewReservedPolicy("test", "wwan0", "93.184.0.0/16"),
+			conflict: true,
+		},
+		{
+			a:        store.NewReservedPolicy("test", "eth0", "*.example.com"),
+			b:        store.NewReservedPolicy("test", "wwan0", "*.cdn.example.com"),
+			conflict: true,
+		},
+		{
+			a: store.NewReservedPolicy("test", "eth0", "*.example.com"),
+			b: store.NewReservedPolicy("test", "wwan0", "*.example.org"),
+		},
+		{
+			a:        store.NewRoutePolicy("test", "eth0", store.Match{Network: "udp"}),
+			b:        store.NewReservedPolicy("test", "wwan0", "*.example.org"),
+			conflict: true,
+		},
+		{
+			a: store.NewRoutePolicy("test", "eth0", store.Match{Network: "udp", Ports: []store.PortRange{{From: 27000, To: 27100}}}),
+			b: store.NewRoutePolicy("test", "wwan0", store.Match{Ports: []store.PortRange{{From: 443, To: 443}}}),
+		},
+		{
+			a: store.NewRoutePolicy("test", "eth0", store.Match{Clients: []string{"192.168.1.50"}}),
+			b: store.NewRoutePolicy("test", "wwan0", store.Match{Clients: []string{"192.168.1.51"}}),
+		},
+		{
+			a:        store.NewRoutePolicy("test", "eth0", store.Match{Clients: []string{"192.168.1.0/24"}}),
+			b:        store.NewRoutePolicy("test", "wwan0", store.Match{Clients: []string{"192.168.1.50"}}),
+			conflict: true,
+		},
+		{
+			a: store.NewReservedPolicy("test", "eth0", "example.com"),
+			b: store.NewBlockPolicy("test", "wwan0"),
+		},
+	}
+	for i, v := range tt {
+		s := store.New(&storage{})
+		if err := s.AppendPolicy(v.a); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		err := s.AppendPolicy(v.b)
+		if v.conflict && err == nil {
+			t.Fatalf("%d: Policy %s should conflict with %s", i, v.b.ID(), v.a.ID())
+		}
+		if !v.conflict && err != nil {
+			t.Fatalf("%d: Unexpected error: %v", i, err)
+		}
+		if err := s.UpdatePolicies(nil, []store.Policy{v.b}); v.conflict && err == nil {
+			t.Fatalf("%d: UpdatePolicies should detect conflicts", i)
+		}
+	}
+}
+
+func TestPersistPolicies_rank(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policies.json")
+
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	p := store.NewAvoidPolicy("test", "wwan0", "example.com")
+	p.SetRank(5, store.EffectAllow)
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	s = store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	priority, effect := s.GetPoliciesSnapshot()[0].(store.Ranked).Rank()
+	if priority != 5 || effect != store.EffectAllow {
+		t.Fatalf("Unexpected rank restored: %d, %s", priority, effect)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default values of the CachingResolver fields.
+const (
+	DefaultResolverTTL         = time.Minute
+	DefaultResolverNegativeTTL = time.Second * 10
+	DefaultResolverTimeout     = time.Second
+	DefaultResolverCacheSize   = 4096
+)
+
+// CachingResolver is a HostResolver that caches the results of another
+// HostResolver. Successful lookups are cached for TTL, failed ones for
+// NegativeTTL. Concurrent lookups of the same name are coalesced into a
+// single request to the underlying resolver.
+// Its zero value is not usable, create instances with NewCachingResolver.
+type CachingResolver struct {
+	resolver HostResolver
+
+	// TTL and NegativeTTL are the durations for which the results
+	// of successful and failed lookups are cached.
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// Timeout bounds the lookups performed on the underlying
+	// resolver, which do not depend on the context of the callers,
+	// as their results are shared.
+	Timeout time.Duration
+	// CacheSize is the maximum number of results cached.
+	CacheSize int
+	// Clock, if set, is used instead of time.Now to tell
+	// the current time. Useful in tests.
+	Clock func() time.Time
+
+	mux      sync.Mutex
+	cache    map[string]*lookupResult
+	inflight map[string]*lookupCall
+}
+
+type lookupResult struct {
+	val     []string
+	err     error
+	expires time.Time
+}
+
+type lookupCall struct {
+	done chan struct{}
+	res  lookupResult
+}
+
+// NewCachingResolver returns a CachingResolver that uses `r` to perform
+// the lookups.
+func NewCachingResolver(r HostResolver) *CachingResolver {
+	return &CachingResolver{
+		resolver:    r,
+		TTL:         DefaultResolverTTL,
+		NegativeTTL: DefaultResolverNegativeTTL,
+		Timeout:     DefaultResolverTimeout,
+		CacheSize:   DefaultResolverCacheSize,
+		cache:       make(map[string]*lookupResult),
+		inflight:    make(map[string]*lookupCall),
+	}
+}
+
+// LookupHost implements HostResolver.
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.lookup(ctx, "host/"+host, func(ctx context.Context) ([]string, error) {
+		return r.resolver.LookupHost(ctx, host)
+	})
+}
+
+// LookupAddr implements HostResolver.
+func (r *CachingResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return r.lookup(ctx, "addr/"+addr, func(ctx context.Context) ([]string, error) {
+		return r.resolver.LookupAddr(ctx, addr)
+	})
+}
+
+func (r *CachingResolver) now() time.Time {
+	if r.Clock != nil {
+		return r.Clock()
+	}
+	return time.Now()
+}
+
+// lookup returns the cached result associated with `key`, if any, or joins
+// the lookup in flight for it, starting one with `f` if needed.
+func (r *CachingResolver) lookup(ctx context.Context, key string, f func(context.Context) ([]string, error)) ([]string, error) {
+	r.mux.Lock()
+	if res, ok := r.cache[key]; ok {
+		if r.now().Before(res.expires) {
+			r.mux.Unlock()
+			return res.val, res.err
+		}
+		delete(r.cache, key)
+	}
+	c, ok := r.inflight[key]
+	if !ok {
+		c = &lookupCall{done: make(chan struct{})}
+		r.inflight[key] = c
+		go r.do(key, c, f)
+	}
+	r.mux.Unlock()
+
+	select {
+	case <-c.done:
+		return c.res.val, c.res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *CachingResolver) do(key string, c *lookupCall, f func(context.Context) ([]string, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+	val, err := f(ctx)
+
+	ttl := r.TTL
+	if err != nil {
+		ttl = r.NegativeTTL
+	}
+	c.res = lookupResult{val: val, err: err, expires: r.now().Add(ttl)}
+
+	r.mux.Lock()
+	delete(r.inflight, key)
+	if ttl > 0 {
+		r.evict()
+		r.cache[key] = &c.res
+	}
+	r.mux.Unlock()
+	close(c.done)
+}
+
+// evict makes room for a new entry in the cache, removing the expired
+// entries first. Must be called with the lock held.
+func (r *CachingResolver) evict() {
+	if r.CacheSize <= 0 || len(r.cache) < r.CacheSize {
+		return
+	}
+	now := r.now()
+	for k, v := range r.cache {
+		if !now.Before(v.expires) {
+			delete(r.cache, k)
+		}
+	}
+	for k := range r.cache {
+		if len(r.cache) < r.CacheSize {
+			break
+		}
+		delete(r.cache, k)
+	}
+}
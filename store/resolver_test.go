@@ -0,0 +1,172 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+// countingResolver counts the lookups it receives, and blocks them
+// until release is closed, if not nil.
+type countingResolver struct {
+	n       int32
+	release chan struct{}
+	err     error
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.n, 1)
+	if r.release != nil {
+		<-r.release
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []string{host}, nil
+}
+
+func (r *countingResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return r.LookupHost(ctx, addr)
+}
+
+func (r *countingResolver) count() int {
+	return int(atomic.LoadInt32(&r.n))
+}
+
+func TestCachingResolver(t *testing.T) {
+	c := &clock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	var mux sync.Mutex
+	now := func() time.Time {
+		mux.Lock()
+		defer mux.Unlock()
+		return c.Now()
+	}
+	advance := func(d time.Duration) {
+		mux.Lock()
+		defer mux.Unlock()
+		c.now = c.now.Add(d)
+	}
+
+	cr := &countingResolver{}
+	r := store.NewCachingResolver(cr)
+	r.Clock = now
+	ctx := context.TODO()
+
+	for i := 0; i < 3; i++ {
+		addrs, err := r.LookupHost(ctx, "example.com")
+		if err != nil || len(addrs) != 1 || addrs[0] != "example.com" {
+			t.Fatalf("%d: Unexpected lookup result: %v, %v", i, addrs, err)
+		}
+	}
+	if cr.count() != 1 {
+		t.Fatalf("Lookups should be cached: %d lookups performed", cr.count())
+	}
+	r.LookupAddr(ctx, "example.com")
+	if cr.count() != 2 {
+		t.Fatalf("Reverse lookups should be cached separately: %d lookups performed", cr.count())
+	}
+
+	advance(r.TTL)
+	r.LookupHost(ctx, "example.com")
+	if cr.count() != 3 {
+		t.Fatalf("Expired results should be looked up again: %d lookups performed", cr.count())
+	}
+
+	// Failures are cached for NegativeTTL.
+	cr.err = errors.New("no such host")
+	for i := 0; i < 2; i++ {
+		if _, err := r.LookupHost(ctx, "example.org"); err == nil {
+			t.Fatalf("%d: Lookup should fail", i)
+		}
+	}
+	if cr.count() != 4 {
+		t.Fatalf("Failures should be cached: %d lookups performed", cr.count())
+	}
+	advance(r.NegativeTTL)
+	r.LookupHost(ctx, "example.org")
+	if cr.count() != 5 {
+		t.Fatalf("Expired failures should be looked up again: %d lookups performed", cr.count())
+	}
+}
+
+func TestCachingResolver_coalescing(t *testing.T) {
+	cr := &countingResolver{release: make(chan struct{})}
+	r := store.NewCachingResolver(cr)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.LookupHost(context.TODO(), "example.com"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	// Callers may give up without affecting the others.
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+	if _, err := r.LookupHost(ctx, "example.com"); err != context.DeadlineExceeded {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	close(cr.release)
+	wg.Wait()
+	if cr.count() != 1 {
+		t.Fatalf("Concurrent lookups should be coalesced: %d lookups performed", cr.count())
+	}
+}
+
+func TestGet_asyncBindHistory(t *testing.T) {
+	defer func(r store.HostResolver) { store.Resolver = r }(store.Resolver)
+	cr := &countingResolver{release: make(chan struct{})}
+	store.Resolver = cr
+
+	s := store.New(new(core.Balancer))
+	s.Put(&mock{id: "s0"})
+	if err := s.AppendPolicy(store.NewStickyPolicy("test", s.QueryBindHistory)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Get does not wait for the lookups of the bind history.
+	if _, err := s.Get(context.TODO(), "example.com:443"); err != nil {
+		t.Fatal(err)
+	}
+	close(cr.release)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if id, ok := s.QueryBindHistory("example.com"); ok {
+			if id != "s0" {
+				t.Fatalf("Unexpected source bound: %v", id)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Bind history should be saved in background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
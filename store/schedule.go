@@ -0,0 +1,217 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"upspin.io/log"
+)
+
+// PurgeInterval is the interval at which SourceStore.Run removes
+// the expired policies.
+var PurgeInterval = time.Second * 10
+
+// TimeBound is an optional interface implemented by policies that are in
+// effect only for a limited amount of time. Every policy of this package
+// implements it.
+type TimeBound interface {
+	// Expiry returns the time after which the policy is no
+	// longer in effect, if any.
+	Expiry() (time.Time, bool)
+	// ActiveAt reports whether the policy is in effect at `t`.
+	ActiveAt(t time.Time) bool
+	// SetSchedule limits the time in which the policy is in effect,
+	// see basePolicy. Nil values remove the limits.
+	SetSchedule(expiresAt *time.Time, w *Window)
+}
+
+// Expiry implements TimeBound.
+func (p basePolicy) Expiry() (time.Time, bool) {
+	if p.ExpiresAt == nil {
+		return time.Time{}, false
+	}
+	return *p.ExpiresAt, true
+}
+
+// ActiveAt implements TimeBound.
+func (p basePolicy) ActiveAt(t time.Time) bool {
+	if p.ExpiresAt != nil && !t.Before(*p.ExpiresAt) {
+		return false
+	}
+	if p.Window != nil && !p.Window.Contains(t) {
+		return false
+	}
+	return true
+}
+
+// SetSchedule implements TimeBound.
+func (p *basePolicy) SetSchedule(expiresAt *time.Time, w *Window) {
+	p.ExpiresAt = expiresAt
+	p.Window = w
+}
+
+// Window is a time window that recurs every day, such as "01:00-05:00".
+// Times are interpreted in the location of the time they are compared
+// with. A window that ends before it starts spans midnight.
+type Window struct {
+	// Start and End are offsets from midnight.
+	Start, End time.Duration
+}
+
+// ParseWindow parses a window in the "15:04-15:04" format.
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	var sh, sm, eh, em int
+	if n, err := fmt.Sscanf(s, "%d:%d-%d:%d", &sh, &sm, &eh, &em); n != 4 || err != nil {
+		return w, fmt.Errorf("invalid window %q, expected hh:mm-hh:mm", s)
+	}
+	for _, v := range []struct{ h, m int }{{sh, sm}, {eh, em}} {
+		if v.h < 0 || v.h > 24 || v.m < 0 || v.m > 59 || (v.h == 24 && v.m != 0) {
+			return w, fmt.Errorf("invalid window %q, expected hh:mm-hh:mm", s)
+		}
+	}
+	w.Start = time.Duration(sh)*time.Hour + time.Duration(sm)*time.Minute
+	w.End = time.Duration(eh)*time.Hour + time.Duration(em)*time.Minute
+	if w.Start == w.End {
+		return w, fmt.Errorf("invalid window %q: empty", s)
+	}
+	return w, nil
+}
+
+// Contains reports whether `t` falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+func (w Window) String() string {
+	f := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return f(w.Start) + "-" + f(w.End)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (w Window) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(w.String())), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (w *Window) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid window %s: %v", data, err)
+	}
+	pw, err := ParseWindow(s)
+	if err != nil {
+		return err
+	}
+	*w = pw
+	return nil
+}
+
+// Now returns the current time, as told by the Clock of the store.
+func (ss *SourceStore) Now() time.Time {
+	if ss.Clock != nil {
+		return ss.Clock()
+	}
+	return time.Now()
+}
+
+// Lifetime reports whether `p` is currently in effect and, if it
+// expires, how long it has left.
+func (ss *SourceStore) Lifetime(p Policy) (active bool, remaining time.Duration, expires bool) {
+	tb, ok := p.(TimeBound)
+	if !ok {
+		return true, 0, false
+	}
+
+	now := ss.Now()
+	if at, ok := tb.Expiry(); ok {
+		remaining, expires = at.Sub(now), true
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	return tb.ActiveAt(now), remaining, expires
+}
+
+// PurgeExpiredPolicies removes the policies that are expired from the
+// store, records them in the audit log and returns them.
+func (ss *SourceStore) PurgeExpiredPolicies() ([]Policy, error) {
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+
+	now := ss.Now()
+	val := make([]Policy, 0, len(ss.policies.val))
+	var expired []Policy
+	for _, p := range ss.policies.val {
+		if tb, ok := p.(TimeBound); ok {
+			if at, ok := tb.Expiry(); ok && !now.Before(at) {
+				expired = append(expired, p)
+				continue
+			}
+		}
+		val = append(val, p)
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	if err := ss.setPolicies(val); err != nil {
+		return nil, err
+	}
+	ss.recordAudit(AuditExpire, expired...)
+	return expired, nil
+}
+
+// Run removes the expired policies, reports the status of the quotas
+// and saves the usage counters every PurgeInterval, until `ctx` is
+// canceled. Expired policies are not in effect even before they are
+// removed.
+func (ss *SourceStore) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			if err := ss.SaveUsage(); err != nil {
+				log.Error.Printf("SourceStore: %v", err)
+			}
+			return ctx.Err()
+		case <-time.After(PurgeInterval):
+		}
+
+		ss.reportQuotas()
+		if err := ss.SaveUsage(); err != nil {
+			log.Error.Printf("SourceStore: %v", err)
+		}
+
+		expired, err := ss.PurgeExpiredPolicies()
+		if err != nil {
+			log.Error.Printf("SourceStore: unable to remove expired policies: %v", err)
+			continue
+		}
+		for _, p := range expired {
+			log.Info.Printf("SourceStore: policy %s expired", p.ID())
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+	"github.com/booster-proj/booster/store"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestWindow(t *testing.T) {
+	day := func(h, m int) time.Time {
+		return time.Date(2019, 3, 1, h, m, 0, 0, time.UTC)
+	}
+	tt := []struct {
+		window string
+		in     []time.Time
+		out    []time.Time
+	}{
+		{
+			window: "01:00-05:00",
+			in:     []time.Time{day(1, 0), day(3, 30), day(4, 59)},
+			out:    []time.Time{day(0, 59), day(5, 0), day(23, 0)},
+		},
+		{
+			window: "22:30-02:00",
+			in:     []time.Time{day(22, 30), day(23, 59), day(0, 0), day(1, 59)},
+			out:    []time.Time{day(2, 0), day(12, 0), day(22, 29)},
+		},
+	}
+	for i, v := range tt {
+		w, err := store.ParseWindow(v.window)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if w.String() != v.window {
+			t.Fatalf("%d: Unexpected window representation: wanted %s, found %s", i, v.window, w)
+		}
+		for _, x := range v.in {
+			if !w.Contains(x) {
+				t.Fatalf("%d: Window %v should contain %v", i, w, x)
+			}
+		}
+		for _, x := range v.out {
+			if w.Contains(x) {
+				t.Fatalf("%d: Window %v should not contain %v", i, w, x)
+			}
+		}
+	}
+
+	for i, v := range []string{"", "01:00", "1-5", "25:00-05:00", "01:60-05:00", "03:00-03:00"} {
+		if _, err := store.ParseWindow(v); err == nil {
+			t.Fatalf("%d: ParseWindow(%q) should fail", i, v)
+		}
+	}
+}
+
+func TestExpiringPolicy(t *testing.T) {
+	c := &clock{now: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)}
+	s := store.New(&storage{data: []core.Source{&mock{id: "s0"}}})
+	s.Clock = c.Now
+
+	p := store.NewBlockPolicy("test", "s0")
+	at := c.now.Add(time.Hour)
+	p.SetSchedule(&at, nil)
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := s.ShouldAccept("s0", "host"); ok {
+		t.Fatal("Policy should be in effect before its expiration")
+	}
+	active, remaining, expires := s.Lifetime(p)
+	if !active || !expires || remaining != time.Hour {
+		t.Fatalf("Unexpected lifetime: active %v, remaining %v, expires %v", active, remaining, expires)
+	}
+	if expired, _ := s.PurgeExpiredPolicies(); len(expired) != 0 {
+		t.Fatalf("Unexpected expired policies: %v", expired)
+	}
+
+	c.now = c.now.Add(time.Hour)
+	if ok, _ := s.ShouldAccept("s0", "host"); !ok {
+		t.Fatal("Policy should not be in effect after its expiration")
+	}
+	expired, err := s.PurgeExpiredPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].ID() != p.ID() {
+		t.Fatalf("Unexpected expired policies: %v", expired)
+	}
+	if len(s.GetPoliciesSnapshot()) != 0 {
+		t.Fatalf("Expired policies should be removed, found %v", s.GetPoliciesSnapshot())
+	}
+
+	// Already expired policies are refused.
+	if err := s.AppendPolicy(p); err == nil {
+		t.Fatal("AppendPolicy should refuse expired policies")
+	}
+}
+
+func TestWindowPolicy(t *testing.T) {
+	store.Resolver = resolver{}
+	c := &clock{now: time.Date(2019, 3, 1, 0, 30, 0, 0, time.UTC)}
+	s := store.New(&storage{data: []core.Source{&mock{id: "wwan0"}}})
+	s.Clock = c.Now
+
+	w, _ := store.ParseWindow("01:00-05:00")
+	p := store.NewReservedPolicy("test", "wwan0", "backup.host")
+	p.SetSchedule(nil, &w)
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := s.ShouldAccept("wwan0", "other.host"); !ok {
+		t.Fatal("Policy should not be in effect outside of its window")
+	}
+	c.now = c.now.Add(time.Hour)
+	if ok, _ := s.ShouldAccept("wwan0", "other.host"); ok {
+		t.Fatal("Policy should be in effect inside of its window")
+	}
+	if active, _, expires := s.Lifetime(p); !active || expires {
+		t.Fatalf("Unexpected lifetime: active %v, expires %v", active, expires)
+	}
+	if expired, _ := s.PurgeExpiredPolicies(); len(expired) != 0 {
+		t.Fatalf("Recurring policies should never expire, found %v", expired)
+	}
+}
+
+func TestPersistPolicies_schedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policies.json")
+
+	s := store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	w, _ := store.ParseWindow("01:00-05:00")
+	p := store.NewBlockPolicy("test", "s0")
+	p.SetSchedule(&at, &w)
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	s = store.New(&storage{})
+	if err := s.PersistPolicies(path); err != nil {
+		t.Fatal(err)
+	}
+	pp := s.GetPoliciesSnapshot()
+	if len(pp) != 1 {
+		t.Fatalf("Unexpected policies restored: %v", pp)
+	}
+	bp := pp[0].(*store.BlockPolicy)
+	if bp.ExpiresAt == nil || !bp.ExpiresAt.Equal(at) {
+		t.Fatalf("Unexpected expiration restored: %v", bp.ExpiresAt)
+	}
+	if bp.Window == nil || *bp.Window != w {
+		t.Fatalf("Unexpected window restored: %v", bp.Window)
+	}
+}
@@ -38,17 +38,47 @@ import (
 type Store interface {
 	Put(...core.Source)
 	Del(...core.Source)
-	Get(context.Context, ...core.Source) (core.Source, error)
+	Get(context.Context, string, ...core.Source) (core.Source, error)
 
 	Len() int
 	Do(func(core.Source))
 }
 
-// A Policy defines wether a connection to `address` should
+// Weighter is an optional interface that the protected Store may
+// implement to allow assigning weights to its sources.
+type Weighter interface {
+	SetWeight(id string, w int) error
+	Weight(id string) int
+}
+
+// Prioritizer is an optional interface that the protected Store may
+// implement to allow grouping its sources into priority tiers.
+type Prioritizer interface {
+	SetTier(id string, t int) error
+	Tier(id string) int
+	ActiveTier() (int, bool)
+}
+
+// CircuitBreaker is an optional interface that the protected Store may
+// implement to keep track of the sources that fail to dial connections,
+// and skip them for a while.
+type CircuitBreaker interface {
+	ReportDial(id string, err error)
+	BreakerState(id string) core.BreakerState
+}
+
+// StrategySwitcher is an optional interface that the protected Store may
+// implement to allow changing the strategy used to select its sources.
+type StrategySwitcher interface {
+	UseStrategy(name string) error
+	StrategyName() string
+}
+
+// A Policy defines wether a connection to target `t` should
 // be accepted by source `id`.
 type Policy interface {
 	ID() string
-	Accept(id, address string) bool
+	Accept(id string, t *Target) bool
 }
 
 // A SourceStore is able to keep sources under a set of
@@ -58,14 +88,47 @@ type Policy interface {
 type SourceStore struct {
 	protected Store
 
+	// Clock, if set, is used instead of time.Now to tell
+	// the current time. Useful in tests.
+	Clock func() time.Time
+
+	// OnQuotaUpdate, if set, is called by Run with the status of each
+	// source quota, every PurgeInterval.
+	OnQuotaUpdate func(QuotaStatus)
+
+	// OnBindHistoryEvent, if set, is called each time the bind
+	// history is hit, missed, or evicts an entry. See BindHistoryHit
+	// and the related constants. It is called while the bind history
+	// is locked, and must not use the store.
+	OnBindHistoryEvent func(event string)
+
 	policies struct {
 		sync.Mutex
 		val []Policy
+		// path of the state file where policies are saved, if any.
+		path string
 	}
 	bindHistory struct {
 		sync.Mutex
 		record bool
-		val    map[string]string
+		val    *bindCache
+		// pending is the number of records being saved
+		// in background.
+		pending int
+	}
+	usage struct {
+		sync.Mutex
+		// val maps each source to the bytes it transferred each day.
+		val       map[string]map[string]int64
+		exhausted map[string]bool
+		// path of the state file where usage is saved, if any.
+		path  string
+		dirty bool
+	}
+	audit struct {
+		sync.Mutex
+		// path of the audit log, if any.
+		path string
 	}
 }
 
@@ -73,7 +136,12 @@ type SourceStore struct {
 // when other components need information about the sources stored,
 // but should not be able to mess with it's actual content.
 type DummySource struct {
-	ID string `json:"name"`
+	ID      string `json:"name"`
+	Weight  int    `json:"weight,omitempty"`
+	Tier    int    `json:"tier"`
+	Breaker string `json:"breaker,omitempty"`
+	// Quota is the status of the quota of the source, if it has one.
+	Quota *QuotaStatus `json:"quota,omitempty"`
 }
 
 // New creates a New instance of SourceStore, using interally `store`
@@ -89,42 +157,76 @@ func New(store Store) *SourceStore {
 // that cannot be accepted due to policy restrictions. The source is then
 // retriven from the protected storage.
 // If `bindHistory.record == true`, the source identifier returned for this address
-// is saved into `bindHistory.val`.
+// is saved into the bind history in background, see SaveBindHistory.
+// The network and the client of the connection, when stored in `ctx` with
+// core.WithNetwork and core.WithClient, are taken into account by the policies.
 func (ss *SourceStore) Get(ctx context.Context, address string, blacklisted ...core.Source) (core.Source, error) {
-	address = TrimPort(address)
+	t := targetFromContext(ctx, address)
+	address = t.Host
 
 	// Combine blacklist received with the one composed by
 	// the policies.
-	blacklisted = append(blacklisted, ss.MakeBlacklist(address)...)
+	blacklisted = append(blacklisted, ss.makeBlacklist(t)...)
 	log.Debug.Printf("SourceStore: Blacklist for %s: %v", address, blacklisted)
 
-	src, err := ss.protected.Get(ctx, blacklisted...)
+	src, err := ss.protected.Get(ctx, address, blacklisted...)
 	if err != nil {
 		return src, err
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
-	defer cancel()
-	ss.SaveBindHistory(ctx, src.ID(), address)
-
+	ss.saveBindHistoryAsync(src.ID(), address)
 	return src, nil
 }
 
+// MaxPendingBindHistory is the maximum number of bind history records that
+// may be saved concurrently in background. Records exceeding it are dropped.
+var MaxPendingBindHistory = 64
+
+// saveBindHistoryAsync calls SaveBindHistory in background, so that the
+// DNS lookups it performs do not delay the caller.
+func (ss *SourceStore) saveBindHistoryAsync(id, address string) {
+	if !ss.recordingBindHistory() {
+		return
+	}
+
+	ss.bindHistory.Lock()
+	if ss.bindHistory.pending >= MaxPendingBindHistory {
+		ss.bindHistory.Unlock()
+		log.Debug.Printf("SourceStore: too many pending bind history records, dropping %s", address)
+		return
+	}
+	ss.bindHistory.pending++
+	ss.bindHistory.Unlock()
+
+	go func() {
+		defer func() {
+			ss.bindHistory.Lock()
+			ss.bindHistory.pending--
+			ss.bindHistory.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ss.SaveBindHistory(ctx, id, address)
+	}()
+}
+
+func (ss *SourceStore) recordingBindHistory() bool {
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+	return ss.bindHistory.record
+}
+
 // SaveBindHistory saves the association of an address with a source. It
 // performs the operation only if it is required, as this is a time
-// consuming operation (potentially, due to DNS lookup).
+// consuming operation (potentially, due to DNS lookup). The bind history
+// is not locked during the lookups.
 func (ss *SourceStore) SaveBindHistory(ctx context.Context, id, address string) {
 	// Save bind history only if required.
-	ss.bindHistory.Lock()
-	defer ss.bindHistory.Unlock()
-	if !ss.bindHistory.record {
+	if !ss.recordingBindHistory() {
 		return
 	}
 
-	if ss.bindHistory.val == nil {
-		ss.bindHistory.val = make(map[string]string)
-	}
-
 	// Find all addresses associated with `address`. First check if
 	// is is an IP address or an hostname. In the former case
 	// find an hostname pointing to this ip.
@@ -150,30 +252,52 @@ func (ss *SourceStore) SaveBindHistory(ctx context.Context, id, address string)
 		return
 	}
 
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+	if !ss.bindHistory.record {
+		// Stopped recording during the lookups.
+		return
+	}
+	if ss.bindHistory.val == nil {
+		ss.bindHistory.val = newBindCache(BindHistorySize, BindHistoryTTL)
+	}
+
+	now := ss.Now()
+	var evicted int
 	for _, v := range addrs {
-		ss.bindHistory.val[v] = id
+		evicted += ss.bindHistory.val.put(v, id, now)
 	}
+	ss.bindHistoryEvent(BindHistoryEviction, evicted)
 }
 
 // ShouldAccept takes `id` and `address`, iterates through the list of policies
-// and returns false if the two inputs are not accepted by one of them. The
-// offending policy is also returned.
-// Returns true if no policy blocks `id` and `address`.
+// and returns the decision of the first one that matches them, together with
+// the policy itself: false if it denies them, true if it allows them.
+// Returns true and no policy if no policy matches `id` and `address`.
+// See Ranked for the order in which the policies are evaluated.
 func (ss *SourceStore) ShouldAccept(id, address string) (bool, Policy) {
-	ss.policies.Lock()
-	defer ss.policies.Unlock()
+	return ss.shouldAccept(id, NewTarget(address))
+}
 
-	if ss.policies.val == nil {
-		return true, nil
-	}
+// shouldAccept implements ShouldAccept. The policies are evaluated without
+// holding the policies lock, as matching a target may require DNS lookups,
+// see Target.IPs: the list of policies is never modified in place, and a
+// change made meanwhile is seen by the next call.
+func (ss *SourceStore) shouldAccept(id string, t *Target) (bool, Policy) {
+	ss.policies.Lock()
+	val := ss.policies.val
+	ss.policies.Unlock()
 
-	// remove port from address if it is present
-	address = TrimPort(address)
-	for _, p := range ss.policies.val {
-		ok := p.Accept(id, address)
-		if !ok {
-			return ok, p
+	now := ss.Now()
+	for _, p := range val {
+		if tb, ok := p.(TimeBound); ok && !tb.ActiveAt(now) {
+			continue
 		}
+		if p.Accept(id, t) {
+			continue
+		}
+		_, effect := rankOf(p)
+		return effect == EffectAllow, p
 	}
 
 	return true, nil
@@ -183,6 +307,10 @@ func (ss *SourceStore) ShouldAccept(id, address string) (bool, Policy) {
 // sources that should not be used to perform a request to `address`, because there
 // is one or more policies that do not accept them.
 func (ss *SourceStore) MakeBlacklist(address string) []core.Source {
+	return ss.makeBlacklist(NewTarget(address))
+}
+
+func (ss *SourceStore) makeBlacklist(t *Target) []core.Source {
 	acc := make([]core.Source, 0, ss.Len())
 
 	// return immediately if there is no policy.
@@ -194,9 +322,10 @@ func (ss *SourceStore) MakeBlacklist(address string) []core.Source {
 		return acc
 	}
 
-	address = TrimPort(address)
+	// The same target is shared across the checks, so that its
+	// addresses are resolved at most once.
 	ss.Do(func(src core.Source) {
-		if ok, _ := ss.ShouldAccept(src.ID(), address); !ok {
+		if ok, _ := ss.shouldAccept(src.ID(), t); !ok {
 			acc = append(acc, src)
 		}
 	})
@@ -214,15 +343,15 @@ func (ss *SourceStore) Do(f func(core.Source)) {
 	ss.protected.Do(f)
 }
 
-// AppendPolicy appends `p` to the end of the list of policies.
+// AppendPolicy appends `p` to the list of policies, after the ones with the
+// same or higher priority. Policies that conflict with the ones already
+// present are rejected. If the store is persisting its policies, the new
+// list is saved before being applied. Once applied, the change is recorded
+// in the audit log, see PersistAudit.
 func (ss *SourceStore) AppendPolicy(p Policy) error {
 	ss.policies.Lock()
 	defer ss.policies.Unlock()
 
-	if ss.policies.val == nil {
-		ss.policies.val = make([]Policy, 0, 1)
-	}
-
 	// Ensure that this is not a duplicate.
 	for _, v := range ss.policies.val {
 		if v.ID() == p.ID() {
@@ -230,16 +359,32 @@ func (ss *SourceStore) AppendPolicy(p Policy) error {
 		}
 	}
 
-	// Eventually append the new policy.
-	ss.policies.val = append(ss.policies.val, p)
-	if p.ID() == "stick" {
-		ss.RecordBindHistory()
+	if tb, ok := p.(TimeBound); ok {
+		if at, ok := tb.Expiry(); ok && !ss.Now().Before(at) {
+			return fmt.Errorf("source store: policy %v is already expired", p.ID())
+		}
+	}
+	if err := validateRank(p); err != nil {
+		return err
+	}
+	if err := checkConflicts(ss.policies.val, p); err != nil {
+		return err
 	}
 
+	// Eventually append the new policy.
+	val := make([]Policy, len(ss.policies.val), len(ss.policies.val)+1)
+	copy(val, ss.policies.val)
+	val = append(val, p)
+	if err := ss.setPolicies(val); err != nil {
+		return err
+	}
+	ss.recordAudit(AuditAdd, p)
 	return nil
 }
 
-// DelPolicy removes the policy with identifier `id` from the storage.
+// DelPolicy removes the policy with identifier `id` from the storage. If the
+// store is persisting its policies, the new list is saved before being applied.
+// Once applied, the change is recorded in the audit log.
 func (ss *SourceStore) DelPolicy(id string) error {
 	ss.policies.Lock()
 	defer ss.policies.Unlock()
@@ -261,16 +406,182 @@ func (ss *SourceStore) DelPolicy(id string) error {
 	if !found {
 		return fmt.Errorf("source store: no %s policy found", id)
 	}
-	// avoid any possible memory leak in the underlying array.
-	ss.policies.val[j] = nil
-	ss.policies.val = append(ss.policies.val[:j], ss.policies.val[j+1:]...)
-	if id == "stick" {
-		ss.StopRecordingBindHistory()
+
+	val := make([]Policy, 0, len(ss.policies.val)-1)
+	val = append(val, ss.policies.val[:j]...)
+	val = append(val, ss.policies.val[j+1:]...)
+	p := ss.policies.val[j]
+	if err := ss.setPolicies(val); err != nil {
+		return err
+	}
+	ss.recordAudit(AuditDelete, p)
+	return nil
+}
+
+// UpdatePolicies removes the policies identified by `del` and appends `add`
+// to the list of policies, as AppendPolicy does, in a single operation: either
+// every change is applied, or none is and an error is returned.
+func (ss *SourceStore) UpdatePolicies(del []string, add []Policy) error {
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+	return ss.updatePolicies(del, add)
+}
+
+// updatePolicies implements UpdatePolicies. Must be called with the
+// policies lock held.
+func (ss *SourceStore) updatePolicies(del []string, add []Policy) error {
+	remove := make(map[string]bool, len(del))
+	for _, id := range del {
+		remove[id] = true
+	}
+
+	val := make([]Policy, 0, len(ss.policies.val)+len(add))
+	present := make(map[string]bool, len(ss.policies.val)+len(add))
+	var removed []Policy
+	for _, v := range ss.policies.val {
+		if remove[v.ID()] {
+			delete(remove, v.ID())
+			removed = append(removed, v)
+			continue
+		}
+		val = append(val, v)
+		present[v.ID()] = true
+	}
+	for id := range remove {
+		return fmt.Errorf("source store: no %s policy found", id)
+	}
+	for _, p := range add {
+		if present[p.ID()] {
+			return fmt.Errorf("source store: a policy with identifier %v is already present", p.ID())
+		}
+		if err := validateRank(p); err != nil {
+			return err
+		}
+		if err := checkConflicts(val, p); err != nil {
+			return err
+		}
+		val = append(val, p)
+		present[p.ID()] = true
+	}
+
+	if err := ss.setPolicies(val); err != nil {
+		return err
 	}
+	ss.recordAudit(AuditDelete, removed...)
+	ss.recordAudit(AuditAdd, add...)
+	return nil
+}
 
+// UpdatePolicy replaces the policy with identifier `id` with the one made
+// from the record returned by `f`, which receives the record of the current
+// policy. The new record is validated, see PolicyRecord.Validate. The new
+// policy keeps the issuer of the old one and takes its place among the
+// policies with the same priority; if the priority changes, the policy is
+// moved among the ones with the new priority, as the list is kept sorted.
+// `issuer`, the issuer of the change, is recorded in the audit log. The type of a policy cannot be changed.
+// The swap is atomic: Get uses either the old or the new policy, and the
+// store never lacks both.
+func (ss *SourceStore) UpdatePolicy(id, issuer string, f func(PolicyRecord) (PolicyRecord, error)) (Policy, error) {
+	ss.policies.Lock()
+	defer ss.policies.Unlock()
+
+	j := -1
+	for i, v := range ss.policies.val {
+		if v.ID() == id {
+			j = i
+			break
+		}
+	}
+	if j < 0 {
+		return nil, fmt.Errorf("source store: no %s policy found", id)
+	}
+	old, ok := MakePolicyRecord(ss.policies.val[j])
+	if !ok {
+		return nil, fmt.Errorf("source store: policy %s cannot be updated", id)
+	}
+
+	r, err := f(old)
+	if err != nil {
+		return nil, err
+	}
+	if r.Code != old.Code {
+		return nil, fmt.Errorf("source store: the type of policy %s cannot be changed", id)
+	}
+	r.Issuer = old.Issuer
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("source store: %v", err)
+	}
+	p, err := ss.MakePolicy(r)
+	if err != nil {
+		return nil, err
+	}
+
+	others := make([]Policy, 0, len(ss.policies.val)-1)
+	others = append(others, ss.policies.val[:j]...)
+	others = append(others, ss.policies.val[j+1:]...)
+	for _, v := range others {
+		if v.ID() == p.ID() {
+			return nil, fmt.Errorf("source store: a policy with identifier %v is already present", v.ID())
+		}
+	}
+	if tb, ok := p.(TimeBound); ok {
+		if at, ok := tb.Expiry(); ok && !ss.Now().Before(at) {
+			return nil, fmt.Errorf("source store: policy %v is already expired", p.ID())
+		}
+	}
+	if err := validateRank(p); err != nil {
+		return nil, err
+	}
+	if err := checkConflicts(others, p); err != nil {
+		return nil, err
+	}
+
+	val := make([]Policy, len(ss.policies.val))
+	copy(val, ss.policies.val)
+	val[j] = p
+	if err := ss.setPolicies(val); err != nil {
+		return nil, err
+	}
+	e := makeAuditEntry(ss.Now(), AuditUpdate, p)
+	e.Issuer = issuer
+	if p.ID() != id {
+		e.PreviousID = id
+	}
+	ss.writeAudit(e)
+	return p, nil
+}
+
+// setPolicies sorts `val` by priority and makes it the list of policies of the
+// store, saving it first if the store is persisting its policies. `val` must
+// not be modified afterwards, as it may be in use by shouldAccept. The bind
+// history is recorded only while the sticky policy is present. Must be called
+// with the policies lock held.
+func (ss *SourceStore) setPolicies(val []Policy) error {
+	sortPolicies(val)
+	if err := ss.savePolicies(val); err != nil {
+		return err
+	}
+
+	was, is := hasSticky(ss.policies.val), hasSticky(val)
+	ss.policies.val = val
+	switch {
+	case is && !was:
+		ss.RecordBindHistory()
+	case !is && was:
+		ss.StopRecordingBindHistory()
+	}
 	return nil
 }
 
+func hasSticky(val []Policy) bool {
+	for _, v := range val {
+		if v.ID() == "stick" {
+			return true
+		}
+	}
+	return false
+}
+
 // Put adds `sources` to the protected storage.
 func (ss *SourceStore) Put(sources ...core.Source) {
 	ss.policies.Lock()
@@ -279,12 +590,21 @@ func (ss *SourceStore) Put(sources ...core.Source) {
 	ss.protected.Put(sources...)
 }
 
-// Del removes `sources` from the protected storage.
+// Del removes `sources` from the protected storage. The addresses bound
+// to them are removed from the bind history.
 func (ss *SourceStore) Del(sources ...core.Source) {
 	ss.policies.Lock()
 	defer ss.policies.Unlock()
 
 	ss.protected.Del(sources...)
+
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+	if ss.bindHistory.val != nil {
+		for _, src := range sources {
+			ss.bindHistory.val.drop(src.ID())
+		}
+	}
 }
 
 // GetPoliciesSnapshot returns a copy of the current policies
@@ -303,22 +623,101 @@ func (ss *SourceStore) GetPoliciesSnapshot() []Policy {
 func (ss *SourceStore) GetSourcesSnapshot() []*DummySource {
 	acc := make([]*DummySource, 0, ss.protected.Len())
 
+	w, _ := ss.protected.(Weighter)
+	p, _ := ss.protected.(Prioritizer)
+	cb, _ := ss.protected.(CircuitBreaker)
+	quotas := ss.Quotas()
 	ss.protected.Do(func(src core.Source) {
-		acc = append(acc, &DummySource{
+		ds := &DummySource{
 			ID: src.ID(),
-		})
+		}
+		if w != nil {
+			ds.Weight = w.Weight(src.ID())
+		}
+		if p != nil {
+			ds.Tier = p.Tier(src.ID())
+		}
+		if cb != nil {
+			ds.Breaker = cb.BreakerState(src.ID()).String()
+		}
+		for i, q := range quotas {
+			if q.SourceID == src.ID() {
+				ds.Quota = &quotas[i]
+			}
+		}
+		acc = append(acc, ds)
 	})
 
 	return acc
 }
 
+// SetWeight assigns weight `w` to the source identified by `id`. Returns
+// an error if the protected storage does not support weights.
+func (ss *SourceStore) SetWeight(id string, w int) error {
+	weighter, ok := ss.protected.(Weighter)
+	if !ok {
+		return fmt.Errorf("source store: protected storage does not support weights")
+	}
+	return weighter.SetWeight(id, w)
+}
+
+// SetTier assigns the source identified by `id` to priority tier `t`.
+// Returns an error if the protected storage does not support priority
+// tiers.
+func (ss *SourceStore) SetTier(id string, t int) error {
+	p, ok := ss.protected.(Prioritizer)
+	if !ok {
+		return fmt.Errorf("source store: protected storage does not support priority tiers")
+	}
+	return p.SetTier(id, t)
+}
+
+// ReportDial forwards the outcome of a dial attempt performed with the source
+// identified by `id` to the protected storage, if it implements CircuitBreaker.
+func (ss *SourceStore) ReportDial(id string, err error) {
+	if cb, ok := ss.protected.(CircuitBreaker); ok {
+		cb.ReportDial(id, err)
+	}
+}
+
+// UseStrategy makes the protected storage select its sources using the
+// strategy registered as `name`. Returns an error if the protected storage
+// does not support switching strategy.
+func (ss *SourceStore) UseStrategy(name string) error {
+	sw, ok := ss.protected.(StrategySwitcher)
+	if !ok {
+		return fmt.Errorf("source store: protected storage does not support switching strategy")
+	}
+	return sw.UseStrategy(name)
+}
+
+// StrategyName returns the name of the strategy used by the protected
+// storage, if available.
+func (ss *SourceStore) StrategyName() string {
+	if sw, ok := ss.protected.(StrategySwitcher); ok {
+		return sw.StrategyName()
+	}
+	return ""
+}
+
+// ActiveTier returns the priority tier of the last source provided by the
+// protected storage. ok is false if the storage does not support priority
+// tiers, or if no source was provided yet.
+func (ss *SourceStore) ActiveTier() (t int, ok bool) {
+	p, ok := ss.protected.(Prioritizer)
+	if !ok {
+		return 0, false
+	}
+	return p.ActiveTier()
+}
+
 // RecordBindHistory makes the store keep track of which source is
 // assigned to which address.
 func (ss *SourceStore) RecordBindHistory() {
 	ss.bindHistory.Lock()
 	defer ss.bindHistory.Unlock()
 
-	ss.bindHistory.val = make(map[string]string)
+	ss.bindHistory.val = newBindCache(BindHistorySize, BindHistoryTTL)
 	ss.bindHistory.record = true
 }
 
@@ -332,6 +731,19 @@ func (ss *SourceStore) StopRecordingBindHistory() {
 	ss.bindHistory.record = false
 }
 
+// PeekBindHistory queries the bindHistory for address, like
+// QueryBindHistory, without affecting the history or reporting
+// any event. It is used by dry runs, see core.WithDryRun.
+func (ss *SourceStore) PeekBindHistory(address string) (src string, ok bool) {
+	ss.bindHistory.Lock()
+	defer ss.bindHistory.Unlock()
+
+	if ss.bindHistory.val == nil {
+		return
+	}
+	return ss.bindHistory.val.peek(address, ss.Now())
+}
+
 // QueryBindHistory queries the bindHistory for address.
 func (ss *SourceStore) QueryBindHistory(address string) (src string, ok bool) {
 	ss.bindHistory.Lock()
@@ -341,6 +753,15 @@ func (ss *SourceStore) QueryBindHistory(address string) (src string, ok bool) {
 		return
 	}
 
-	src, ok = ss.bindHistory.val[address]
-	return
+	src, ok, evicted := ss.bindHistory.val.get(address, ss.Now())
+	switch {
+	case ok:
+		ss.bindHistoryEvent(BindHistoryHit, 1)
+	case evicted:
+		ss.bindHistoryEvent(BindHistoryEviction, 1)
+		fallthrough
+	default:
+		ss.bindHistoryEvent(BindHistoryMiss, 1)
+	}
+	return src, ok
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/booster-proj/booster/core"
 	"github.com/booster-proj/booster/store"
@@ -117,6 +118,135 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestGet_network(t *testing.T) {
+	s0 := &mock{id: "s0"}
+	s1 := &mock{id: "s1"}
+	st := &storage{
+		index: 0,
+		data:  []core.Source{s0, s1},
+	}
+	s := store.New(st)
+	s.AppendPolicy(store.NewRoutePolicy("T", s1.ID(), store.Match{Network: "udp", Ports: []store.PortRange{{From: 27000, To: 27100}}}))
+
+	// s0 cannot be used for game traffic.
+	ctx := core.WithNetwork(context.Background(), "udp4")
+	src, err := s.Get(ctx, "game.server:27015")
+	if err == nil {
+		t.Fatalf("Unexpected source %v, we should have received an error instead", src)
+	}
+
+	st.index = 1 // make storage return s1
+	src, err = s.Get(ctx, "game.server:27015")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if src.ID() != s1.ID() {
+		t.Fatalf("Unexpected source: wanted %s, found %s", s1, src)
+	}
+
+	st.index = 0
+	ctx = core.WithNetwork(context.Background(), "tcp4")
+	src, err = s.Get(ctx, "game.server:27015")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if src.ID() != s0.ID() {
+		t.Fatalf("Unexpected source: wanted %s, found %s", s0, src)
+	}
+}
+
+func TestGet_client(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(new(core.Balancer))
+	s.Put(&mock{id: "eth0"}, &mock{id: "wwan0"})
+	p := store.NewRoutePolicy("test", "wwan0", store.Match{Clients: []string{"192.168.1.50"}})
+	if err := s.AppendPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := core.WithClient(context.TODO(), "192.168.1.50:51234")
+	for i := 0; i < 3; i++ {
+		src, err := s.Get(ctx, "example.com:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != "wwan0" {
+			t.Fatalf("%d: Unexpected source for the routed client: %v", i, src.ID())
+		}
+	}
+
+	seen := make(map[string]bool)
+	ctx = core.WithClient(context.TODO(), "192.168.1.60:51234")
+	for i := 0; i < 4; i++ {
+		src, err := s.Get(ctx, "example.com:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[src.ID()] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("Other clients should use every source, found %v", seen)
+	}
+}
+
+// slowResolver blocks each lookup until release is closed,
+// signalling it on called.
+type slowResolver struct {
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (r slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.called <- struct{}{}
+	<-r.release
+	return []string{"10.0.0.1"}, nil
+}
+
+func (r slowResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return nil, fmt.Errorf("no hosts found")
+}
+
+func TestGet_slowLookup(t *testing.T) {
+	r := slowResolver{called: make(chan struct{}, 1), release: make(chan struct{})}
+	defer func(old store.HostResolver) { store.Resolver = old }(store.Resolver)
+	store.Resolver = r
+
+	s := store.New(new(core.Balancer))
+	s.Put(&mock{id: "eth0"}, &mock{id: "wwan0"})
+	if err := s.AppendPolicy(store.NewReservedPolicy("test", "wwan0", "10.0.0.0/8")); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		src, err := s.Get(context.TODO(), "example.com:443")
+		if err == nil && src.ID() != "wwan0" {
+			err = fmt.Errorf("unexpected source %v", src.ID())
+		}
+		errc <- err
+	}()
+
+	// The store is not locked while the target is being resolved.
+	<-r.called
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.AppendPolicy(store.NewBlockPolicy("test", "eth0"))
+		s.GetPoliciesSnapshot()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		close(r.release)
+		t.Fatal("The policies were locked during the lookup")
+	}
+
+	close(r.release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestMakeBlacklist(t *testing.T) {
 	s0 := &mock{id: "s0"}
 	s1 := &mock{id: "s1"}
@@ -292,6 +422,196 @@ func TestDelPolicy(t *testing.T) {
 
 }
 
+func TestUpdatePolicies(t *testing.T) {
+	store.Resolver = resolver{
+		host:  "some.host",
+		addrs: []string{"192.168.0.1"},
+	}
+	s := store.New(&storage{
+		data: []core.Source{},
+	})
+	gen := func(name string) store.Policy {
+		return &store.GenPolicy{
+			Name:       name,
+			AcceptFunc: func(id, address string) bool { return true },
+		}
+	}
+	s.AppendPolicy(gen("foo"))
+	s.AppendPolicy(gen("bar"))
+
+	if err := s.UpdatePolicies([]string{"foo"}, []store.Policy{gen("baz"), store.NewStickyPolicy("test", s.QueryBindHistory)}); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"bar", "baz", "stick"}
+	pl := s.GetPoliciesSnapshot()
+	if len(pl) != len(ids) {
+		t.Fatalf("Unexpected policies count: wanted %d, found %+v", len(ids), pl)
+	}
+	for i, v := range pl {
+		if v.ID() != ids[i] {
+			t.Fatalf("%d: Unexpected policy: wanted %s, found %s", i, ids[i], v.ID())
+		}
+	}
+	s.SaveBindHistory(context.Background(), "s0", "192.168.0.1")
+
+	// Failing updates should not change anything.
+	if err := s.UpdatePolicies([]string{"bar"}, []store.Policy{gen("baz")}); err == nil {
+		t.Fatal("Adding a duplicate policy should fail")
+	}
+	if err := s.UpdatePolicies([]string{"stick", "foo"}, nil); err == nil {
+		t.Fatal("Removing a missing policy should fail")
+	}
+	if len(s.GetPoliciesSnapshot()) != len(ids) {
+		t.Fatalf("Unexpected policies after failed updates: %+v", s.GetPoliciesSnapshot())
+	}
+	if _, ok := s.QueryBindHistory("192.168.0.1"); !ok {
+		t.Fatal("Failed updates should not reset the bind history")
+	}
+
+	if err := s.UpdatePolicies([]string{"stick"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.QueryBindHistory("192.168.0.1"); ok {
+		t.Fatal("Bind history should not be recorded without the sticky policy")
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{})
+	rp := store.NewReservedPolicy("alice", "eth0", "example.com")
+	rp.Reason = "games"
+	if err := s.UpdatePolicies(nil, []store.Policy{
+		store.NewBlockPolicy("test", "wwan0"),
+		rp,
+		store.NewBlockPolicy("test", "wwan1"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.UpdatePolicy(rp.ID(), "bob", func(r store.PolicyRecord) (store.PolicyRecord, error) {
+		r.Hosts = append(r.Hosts, "example.net")
+		r.Issuer = "bob"
+		return r, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := s.GetPoliciesSnapshot()
+	if len(pl) != 3 || pl[1] != p {
+		t.Fatalf("Policy should be swapped in place: %v", pl)
+	}
+	np := p.(*store.ReservedPolicy)
+	if len(np.Hosts) != 2 || np.Issuer != "alice" || np.Reason != "games" {
+		t.Fatalf("Unexpected updated policy: %+v", np)
+	}
+
+	// Failing updates should not change anything.
+	tt := []struct {
+		id string
+		f  func(store.PolicyRecord) (store.PolicyRecord, error)
+	}{
+		{id: "reserve_eth1", f: func(r store.PolicyRecord) (store.PolicyRecord, error) { return r, nil }},
+		{id: rp.ID(), f: func(r store.PolicyRecord) (store.PolicyRecord, error) { return r, fmt.Errorf("invalid") }},
+		{id: rp.ID(), f: func(r store.PolicyRecord) (store.PolicyRecord, error) {
+			r.Code = store.PolicyCodeBlock
+			return r, nil
+		}},
+		{id: "block_wwan0", f: func(r store.PolicyRecord) (store.PolicyRecord, error) {
+			r.SourceID = "wwan1"
+			return r, nil
+		}},
+		{id: rp.ID(), f: func(r store.PolicyRecord) (store.PolicyRecord, error) {
+			r.Hosts = nil
+			return r, nil
+		}},
+		{id: rp.ID(), f: func(r store.PolicyRecord) (store.PolicyRecord, error) {
+			r.Effect = store.EffectAllow
+			return r, nil
+		}},
+		{id: rp.ID(), f: func(r store.PolicyRecord) (store.PolicyRecord, error) {
+			at := time.Now().Add(-time.Minute)
+			r.ExpiresAt = &at
+			return r, nil
+		}},
+	}
+	for i, v := range tt {
+		if _, err := s.UpdatePolicy(v.id, "bob", v.f); err == nil {
+			t.Fatalf("%d: UpdatePolicy should fail", i)
+		}
+		if ids := policyIDs(s); len(ids) != 3 || ids[1] != rp.ID() {
+			t.Fatalf("%d: Unexpected policies after failed update: %v", i, ids)
+		}
+	}
+}
+
+func TestUpdatePolicy_priority(t *testing.T) {
+	s := store.New(&storage{})
+	if err := s.UpdatePolicies(nil, []store.Policy{
+		store.NewBlockPolicy("test", "wwan0"),
+		store.NewBlockPolicy("test", "wwan1"),
+		store.NewBlockPolicy("test", "wwan2"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the priority moves the policy among the ones
+	// with the new priority.
+	if _, err := s.UpdatePolicy("block_wwan2", "bob", func(r store.PolicyRecord) (store.PolicyRecord, error) {
+		r.Priority = 10
+		return r, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"block_wwan2", "block_wwan0", "block_wwan1"}
+	ids := policyIDs(s)
+	if len(ids) != len(want) {
+		t.Fatalf("Unexpected policies: wanted %v, found %v", want, ids)
+	}
+	for i, v := range want {
+		if ids[i] != v {
+			t.Fatalf("Unexpected policies: wanted %v, found %v", want, ids)
+		}
+	}
+}
+
+func TestUpdatePolicy_concurrent(t *testing.T) {
+	store.Resolver = resolver{}
+	s := store.New(&storage{data: []core.Source{&mock{id: "eth0"}, &mock{id: "wwan0"}}})
+	if err := s.AppendPolicy(store.NewReservedPolicy("test", "eth0", "example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, err := s.UpdatePolicy("reserve_eth0", "test", func(r store.PolicyRecord) (store.PolicyRecord, error) {
+				r.Hosts = []string{"example.com", fmt.Sprintf("host%d.example.org", i)}
+				return r, nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		src, err := s.Get(context.TODO(), "example.com:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.ID() != "eth0" {
+			t.Fatalf("Reserved host should never use another source, found %s", src.ID())
+		}
+	}
+}
+
 func TestGetPoliciesSnapshot(t *testing.T) {
 	s := store.New(&storage{
 		data: []core.Source{},
@@ -314,6 +634,30 @@ func TestGetPoliciesSnapshot(t *testing.T) {
 	}
 }
 
+func TestSetWeight(t *testing.T) {
+	s := store.New(&storage{})
+	if err := s.SetWeight("s0", 2); err == nil {
+		t.Fatal("Unexpected nil error: storage does not support weights")
+	}
+
+	b := &core.Balancer{}
+	b.Put(&mock{id: "s0"}, &mock{id: "s1"})
+	s = store.New(b)
+	if err := s.SetWeight("s0", 2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, v := range s.GetSourcesSnapshot() {
+		want := 1
+		if v.ID == "s0" {
+			want = 2
+		}
+		if v.Weight != want {
+			t.Fatalf("Unexpected weight of source %s: wanted %d, found %d", v.ID, want, v.Weight)
+		}
+	}
+}
+
 type mock struct {
 	id     string
 	active bool
@@ -376,7 +720,7 @@ func (s *storage) Do(f func(core.Source)) {
 	}
 }
 
-func (s *storage) Get(ctx context.Context, blacklisted ...core.Source) (core.Source, error) {
+func (s *storage) Get(ctx context.Context, target string, blacklisted ...core.Source) (core.Source, error) {
 	isIn := func(s core.Source) bool {
 		for _, v := range blacklisted {
 			if v.ID() == s.ID() {
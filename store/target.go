@@ -0,0 +1,400 @@
+// Copyright © 2019 KIM KeepInMind GmbH/srl
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/booster-proj/booster/core"
+)
+
+// Target describes the destination of a connection, as it is
+// presented to the policies.
+type Target struct {
+	// Host is the hostname or IP address requested, without port.
+	Host string
+	// Port is the destination port, 0 if unknown.
+	Port int
+	// Network is either "tcp" or "udp".
+	Network string
+	// Client is the address of the client that requested the
+	// connection, nil if unknown.
+	Client net.IP
+
+	// dryRun tells whether the target comes from a dry run,
+	// see core.WithDryRun.
+	dryRun bool
+
+	once sync.Once
+	ips  []net.IP
+
+	history struct {
+		once sync.Once
+		id   string
+		ok   bool
+	}
+}
+
+// NewTarget returns the Target of a connection to `address`, which
+// may contain port information. Network defaults to "tcp".
+func NewTarget(address string) *Target {
+	t := &Target{Host: TrimPort(address), Network: "tcp"}
+	if _, port, err := net.SplitHostPort(address); err == nil {
+		t.Port, _ = strconv.Atoi(port)
+	}
+	return t
+}
+
+// targetFromContext returns the Target of a connection to `address`,
+// taking its network and client from `ctx`, see core.WithNetwork and
+// core.WithClient, and whether it comes from a dry run.
+func targetFromContext(ctx context.Context, address string) *Target {
+	t := NewTarget(address)
+	t.dryRun = core.IsDryRun(ctx)
+	if network, ok := core.NetworkFromContext(ctx); ok {
+		t.Network = normalizeNetwork(network)
+	}
+	if client, ok := core.ClientFromContext(ctx); ok {
+		t.Client = net.ParseIP(TrimPort(client))
+	}
+	return t
+}
+
+// IPs returns the IP addresses of the target. When Host is a hostname,
+// it is resolved the first time IPs is called.
+func (t *Target) IPs() []net.IP {
+	t.once.Do(func() {
+		if ip := net.ParseIP(t.Host); ip != nil {
+			t.ips = []net.IP{ip}
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		addrs, err := Resolver.LookupHost(ctx, t.Host)
+		if err != nil {
+			return
+		}
+		for _, v := range addrs {
+			if ip := net.ParseIP(v); ip != nil {
+				t.ips = append(t.ips, ip)
+			}
+		}
+	})
+	return t.ips
+}
+
+// boundSource returns the source that the target is bound to according to
+// `query`, see StickyPolicy. The bind history is queried the first time
+// boundSource is called, so that each target reports a single hit or miss
+// however many sources are checked against it.
+func (t *Target) boundSource(query HistoryQueryFunc) (string, bool) {
+	t.history.once.Do(func() {
+		t.history.id, t.history.ok = query(t.Host)
+	})
+	return t.history.id, t.history.ok
+}
+
+// hostMatcher matches targets against a host pattern, which may be
+// a CIDR range ("10.0.0.0/8"), an IP address, a wildcard domain
+// ("*.example.com") or an exact hostname.
+type hostMatcher struct {
+	ipnet  *net.IPNet
+	suffix string
+	host   string
+	// addresses associated with host when the matcher was created,
+	// used only to describe it. Targets are matched against the
+	// addresses host resolves to when they are checked.
+	addrs []string
+}
+
+// ValidateHostPattern returns an error if `pattern` is not a valid
+// host pattern for policies.
+func ValidateHostPattern(pattern string) error {
+	pattern = TrimPort(pattern)
+	switch {
+	case pattern == "":
+		return fmt.Errorf("empty host pattern")
+	case strings.Contains(pattern, "/"):
+		if _, _, err := net.ParseCIDR(pattern); err != nil {
+			return fmt.Errorf("invalid CIDR range %q: %v", pattern, err)
+		}
+	case strings.Contains(pattern, "*"):
+		if !strings.HasPrefix(pattern, "*.") || strings.Contains(pattern[2:], "*") || len(pattern) == 2 {
+			return fmt.Errorf("invalid wildcard domain %q, expected *.domain", pattern)
+		}
+	}
+	return nil
+}
+
+func newHostMatcher(pattern string) hostMatcher {
+	pattern = TrimPort(pattern)
+	if _, ipnet, err := net.ParseCIDR(pattern); err == nil {
+		return hostMatcher{ipnet: ipnet}
+	}
+	if ip := net.ParseIP(pattern); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return hostMatcher{ipnet: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return hostMatcher{suffix: canonicalHost(pattern[1:])}
+	}
+	return hostMatcher{
+		host:  canonicalHost(pattern),
+		addrs: LookupAddress(pattern),
+	}
+}
+
+// Addrs returns the addresses that describe the matcher, i.e. the
+// resolved addresses of exact hosts, or the pattern itself.
+func (m hostMatcher) Addrs() []string {
+	switch {
+	case m.ipnet != nil:
+		return []string{m.ipnet.String()}
+	case m.suffix != "":
+		return []string{"*" + m.suffix}
+	default:
+		return m.addrs
+	}
+}
+
+func (m hostMatcher) match(t *Target) bool {
+	host := canonicalHost(t.Host)
+	switch {
+	case m.ipnet != nil:
+		for _, ip := range t.IPs() {
+			if m.ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	case m.suffix != "":
+		return strings.HasSuffix(host, m.suffix)
+	default:
+		if host == m.host {
+			return true
+		}
+		// Targets requested by IP match the current addresses of
+		// the host, which may change over time, e.g. behind a CDN.
+		// Lookups are cached by the default Resolver.
+		ip := net.ParseIP(t.Host)
+		if ip == nil {
+			return false
+		}
+		for _, v := range LookupAddress(m.host) {
+			if addr := net.ParseIP(v); addr != nil && addr.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func canonicalHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func matchAny(matchers []hostMatcher, t *Target) bool {
+	for _, m := range matchers {
+		if m.match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// PortRange is an inclusive range of ports. It is encoded as "443"
+// when it contains a single port, or as "27000-27100" otherwise.
+type PortRange struct {
+	From, To int
+}
+
+// ParsePortRange parses `s`, which is either a port or two ports
+// separated by a dash.
+func ParsePortRange(s string) (PortRange, error) {
+	from, to := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		from, to = s[:i], s[i+1:]
+	}
+
+	var r PortRange
+	var err error
+	if r.From, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+		return r, fmt.Errorf("invalid port range %q", s)
+	}
+	if r.To, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+		return r, fmt.Errorf("invalid port range %q", s)
+	}
+	if r.From < 1 || r.To > 65535 || r.From > r.To {
+		return r, fmt.Errorf("invalid port range %q", s)
+	}
+	return r, nil
+}
+
+// Contains reports whether `port` is inside the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.From && port <= r.To
+}
+
+func (r PortRange) String() string {
+	if r.From == r.To {
+		return strconv.Itoa(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r PortRange) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(r.String())), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Both strings and
+// numbers are accepted.
+func (r *PortRange) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	pr, err := ParsePortRange(s)
+	if err != nil {
+		return err
+	}
+	*r = pr
+	return nil
+}
+
+// Match restricts the connections a policy applies to, by network,
+// destination port and client. Its zero value matches every connection.
+type Match struct {
+	// Network is either "tcp", "udp" or empty, meaning any network.
+	Network string `json:"network,omitempty"`
+	// Ports is the list of port ranges matched, or empty to
+	// match any port.
+	Ports []PortRange `json:"ports,omitempty"`
+	// Clients is the list of client IP addresses or CIDR ranges
+	// matched, or empty to match any client. Connections whose
+	// client is unknown are not matched by a non-empty list.
+	Clients []string `json:"clients,omitempty"`
+}
+
+// ValidateClient returns an error if `pattern` is neither an IP address
+// nor a CIDR range.
+func ValidateClient(pattern string) error {
+	if _, err := parseClient(pattern); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseClient parses an IP address or a CIDR range into a network.
+func parseClient(pattern string) (*net.IPNet, error) {
+	if _, ipnet, err := net.ParseCIDR(pattern); err == nil {
+		return ipnet, nil
+	}
+	ip := net.ParseIP(pattern)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid client %q, expected an IP address or a CIDR range", pattern)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func (m Match) matchClient(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, v := range m.Clients {
+		if ipnet, err := parseClient(v); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateNetwork returns an error if `network` is not a network
+// that can be matched by policies.
+func ValidateNetwork(network string) error {
+	switch network {
+	case "", "tcp", "udp":
+		return nil
+	default:
+		return fmt.Errorf("invalid network %q, expected tcp or udp", network)
+	}
+}
+
+// IsZero reports whether `m` matches every connection.
+func (m Match) IsZero() bool {
+	return m.Network == "" && len(m.Ports) == 0 && len(m.Clients) == 0
+}
+
+func (m Match) match(t *Target) bool {
+	if m.Network != "" && m.Network != t.Network {
+		return false
+	}
+	if len(m.Clients) > 0 && !m.matchClient(t.Client) {
+		return false
+	}
+	if len(m.Ports) == 0 {
+		return true
+	}
+	for _, r := range m.Ports {
+		if r.Contains(t.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns a compact representation of `m`, such as "udp:27000-27100",
+// "tcp:80,443" or "tcp_from_192.168.1.10", suitable to be used in policy
+// identifiers.
+func (m Match) String() string {
+	ports := make([]string, len(m.Ports))
+	for i, r := range m.Ports {
+		ports[i] = r.String()
+	}
+	var s string
+	switch {
+	case m.Network == "":
+		s = strings.Join(ports, ",")
+	case len(ports) == 0:
+		s = m.Network
+	default:
+		s = m.Network + ":" + strings.Join(ports, ",")
+	}
+	if len(m.Clients) > 0 {
+		s = joinNonEmpty("_", s, "from_"+strings.Join(m.Clients, ","))
+	}
+	return s
+}
+
+// normalizeNetwork removes the IP version from `network`, i.e.
+// "tcp4" becomes "tcp".
+func normalizeNetwork(network string) string {
+	return strings.TrimRight(network, "46")
+}